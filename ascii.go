@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// --ascii-mode values.
+const (
+	asciiReplace = "replace" // transliterate where possible, "?" otherwise
+	asciiStrip   = "strip"   // drop non-ASCII runes
+	asciiReport  = "report"  // leave content alone, list where they are
+)
+
+func isValidASCIIMode(v string) bool {
+	return v == asciiReplace || v == asciiStrip || v == asciiReport
+}
+
+// asciiReplacements are the look-alikes that creep in from copied docs and
+// have an obvious ASCII spelling. Invisible characters map to "".
+var asciiReplacements = map[rune]string{
+	'\u2018': "'", '\u2019': "'", '\u201a': "'", '\u2032': "'",
+	'\u201c': `"`, '\u201d': `"`, '\u201e': `"`, '\u2033': `"`,
+	'\u2010': "-", '\u2011': "-", '\u2012': "-", '\u2013': "-", '\u2014': "-", '\u2212': "-",
+	'\u2026': "...",
+	'\u00a0': " ", '\u2002': " ", '\u2003': " ", '\u2009': " ", '\u202f': " ",
+	'\u200b': "", '\u200c': "", '\u200d': "", '\u2060': "", '\ufeff': "",
+	'\u2022': "*",
+	'\u00d7': "x",
+}
+
+// maxASCIIReports caps the locations listed by --ascii-mode report.
+const maxASCIIReports = 50
+
+// asciiSink decorates a sink with --ascii-only. Writes can end in the middle
+// of a multibyte rune, so an incomplete tail is held back until the next write.
+type asciiSink struct {
+	sink
+	mode     string
+	carry    []byte
+	line     int
+	col      int
+	affected int
+}
+
+func newASCIISink(inner sink, mode string) *asciiSink {
+	return &asciiSink{sink: inner, mode: mode, line: 1, col: 1}
+}
+
+func (s *asciiSink) Write(p []byte) (int, error) {
+	buf := append(s.carry, p...)
+	s.carry = nil
+	var out strings.Builder
+	for len(buf) > 0 {
+		r, size := utf8.DecodeRune(buf)
+		if r == utf8.RuneError && size <= 1 && !utf8.FullRune(buf) {
+			s.carry = append([]byte(nil), buf...)
+			break
+		}
+		s.rune(&out, r, buf[:size])
+		buf = buf[size:]
+	}
+	if _, err := s.sink.Write([]byte(out.String())); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *asciiSink) rune(out *strings.Builder, r rune, raw []byte) {
+	if r < utf8.RuneSelf && len(raw) == 1 {
+		out.WriteByte(raw[0])
+		if r == '\n' {
+			s.line++
+			s.col = 1
+		} else {
+			s.col++
+		}
+		return
+	}
+	s.affected++
+	switch s.mode {
+	case asciiReport:
+		if s.affected <= maxASCIIReports {
+			warnf("Non-ASCII %s at line %d, column %d\n", describeRune(r, raw), s.line, s.col)
+		}
+		out.Write(raw)
+	case asciiReplace:
+		rep, ok := asciiReplacements[r]
+		if !ok {
+			rep = "?"
+		}
+		out.WriteString(rep)
+	}
+	s.col++
+}
+
+func describeRune(r rune, raw []byte) string {
+	if r == utf8.RuneError && len(raw) == 1 {
+		return fmt.Sprintf("invalid byte 0x%02x", raw[0])
+	}
+	return fmt.Sprintf("U+%04X %q", r, r)
+}
+
+func (s *asciiSink) Close() error {
+	// Whatever is still held back can never complete: treat it as invalid.
+	var out strings.Builder
+	for _, b := range s.carry {
+		s.rune(&out, utf8.RuneError, []byte{b})
+	}
+	s.carry = nil
+	if out.Len() > 0 {
+		s.sink.Write([]byte(out.String()))
+	}
+	if s.affected > 0 {
+		if s.mode == asciiReport && s.affected > maxASCIIReports {
+			warnf("... and %d more\n", s.affected-maxASCIIReports)
+		}
+		verb := map[string]string{asciiReplace: "Replaced", asciiStrip: "Stripped", asciiReport: "Found"}[s.mode]
+		warnf("%s %d non-ASCII character(s)\n", verb, s.affected)
+	}
+	return s.sink.Close()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+// clipboardTimeout bounds every clipboard read and write (--clipboard-timeout).
+// Backends such as xclip can block forever on a misconfigured display; 0
+// waits indefinitely.
+var clipboardTimeout = 10 * time.Second
+
+// The clipboard backends, as variables so tests can stand in fakes.
+var (
+	clipboardWriteAll   = clipboard.WriteAll
+	typedClipboardWrite = writeTypedClipboard
+)
+
+// errClipboardTimeout is returned when the backend didn't answer in time.
+type errClipboardTimeout struct{ after time.Duration }
+
+func (e errClipboardTimeout) Error() string {
+	return fmt.Sprintf("clipboard backend did not respond within %s; use --stdout or --out <file> instead", e.after)
+}
+
+// withClipboardTimeout runs fn, giving up after clipboardTimeout. atotto's
+// clipboard takes no context, so a timed-out call is left running in its
+// goroutine; the process exits soon after anyway.
+func withClipboardTimeout(fn func() error) error {
+	if clipboardTimeout <= 0 {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	timer := time.NewTimer(clipboardTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errClipboardTimeout{clipboardTimeout}
+	}
+}
+
+func readClipboard() (string, error) {
+	var s string
+	err := withClipboardTimeout(func() error {
+		var err error
+		s, err = clipboard.ReadAll()
+		return err
+	})
+	return s, err
+}
+
+func writeClipboard(s string) error {
+	write := clipboardWriteAll
+	return withClipboardTimeout(func() error { return write(s) })
+}
@@ -0,0 +1,9 @@
+//go:build !(freebsd || linux || netbsd || openbsd || solaris || dragonfly)
+
+package main
+
+// writeTypedClipboard has no typed backend outside of X11 and Wayland: pbcopy
+// and the Windows clipboard API as used here only take plain text.
+func writeTypedClipboard(content string, mime string) (ok bool, err error) {
+	return false, nil
+}
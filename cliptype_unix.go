@@ -0,0 +1,41 @@
+//go:build freebsd || linux || netbsd || openbsd || solaris || dragonfly
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// writeTypedClipboard copies content with a MIME type through wl-copy
+// (Wayland) or xclip (X11). ok is false when neither is available; xsel has
+// no notion of types.
+func writeTypedClipboard(content string, mime string) (ok bool, err error) {
+	var cmd *exec.Cmd
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if p, err := exec.LookPath("wl-copy"); err == nil {
+			args := []string{"--type", mime}
+			if clipboard.Primary {
+				args = append(args, "--primary")
+			}
+			cmd = exec.Command(p, args...)
+		}
+	}
+	if cmd == nil {
+		if p, err := exec.LookPath("xclip"); err == nil {
+			sel := "clipboard"
+			if clipboard.Primary {
+				sel = "primary"
+			}
+			cmd = exec.Command(p, "-selection", sel, "-t", mime, "-in")
+		}
+	}
+	if cmd == nil {
+		return false, nil
+	}
+	cmd.Stdin = strings.NewReader(content)
+	return true, cmd.Run()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Code block extraction for href --code-blocks. Like --text it is a regexp
+// pass over the page rather than a parser.
+var (
+	htmlPre       = regexp.MustCompile(`(?is)<pre\b([^>]*)>(.*?)</pre\s*>`)
+	htmlCode      = regexp.MustCompile(`(?is)<code\b([^>]*)>(.*?)</code\s*>`)
+	htmlCodeOpen  = regexp.MustCompile(`(?is)^\s*<code\b([^>]*)>`)
+	htmlLangClass = regexp.MustCompile(`(?i)\b(?:language|lang)-([\w+#.-]+)`)
+)
+
+// codeBlock is one code sample from a page. lang is the fence language, when
+// the page names one or the first line gives it away.
+type codeBlock struct {
+	lang    string
+	content string
+}
+
+// extractCodeBlocks returns the code samples in a fetched page: <pre> blocks
+// and multi-line <code> elements for HTML, fenced blocks for anything else
+// (Markdown and plain text).
+func extractCodeBlocks(src string, isHTML bool) []codeBlock {
+	var blocks []codeBlock
+	if isHTML {
+		blocks = htmlCodeBlocks(src)
+	} else {
+		blocks = fencedCodeBlocks(src)
+	}
+	for i, b := range blocks {
+		if b.lang == "" {
+			first, _, _ := strings.Cut(b.content, "\n")
+			blocks[i].lang = fenceLanguage(detectLanguage("", first))
+		}
+	}
+	return blocks
+}
+
+func htmlCodeBlocks(src string) []codeBlock {
+	src = htmlNoise.ReplaceAllString(src, "")
+	var blocks []codeBlock
+	add := func(attrs string, inner string) {
+		lang := ""
+		if m := htmlLangClass.FindStringSubmatch(attrs); m != nil {
+			lang = strings.ToLower(m[1])
+		} else if m := htmlCodeOpen.FindStringSubmatch(inner); m != nil {
+			if m := htmlLangClass.FindStringSubmatch(m[1]); m != nil {
+				lang = strings.ToLower(m[1])
+			}
+		}
+		text := html.UnescapeString(htmlTag.ReplaceAllString(inner, ""))
+		text = strings.TrimLeft(text, "\r\n")
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		blocks = append(blocks, codeBlock{lang: lang, content: text})
+	}
+	for _, m := range htmlPre.FindAllStringSubmatch(src, -1) {
+		add(m[1], m[2])
+	}
+	// <code> outside <pre> is usually inline; only multi-line ones are blocks.
+	for _, m := range htmlCode.FindAllStringSubmatch(htmlPre.ReplaceAllString(src, ""), -1) {
+		if strings.Contains(strings.TrimSpace(m[2]), "\n") {
+			add(m[1], m[2])
+		}
+	}
+	return blocks
+}
+
+// fencedCodeBlocks finds ``` and ~~~ fences. A fence closes on a line of at
+// least as many of the same character; an unclosed fence runs to the end.
+func fencedCodeBlocks(src string) []codeBlock {
+	var blocks []codeBlock
+	var cur *codeBlock
+	var body strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(src, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		indented := strings.TrimLeft(trimmed, " ")
+		if len(trimmed)-len(indented) > 3 {
+			indented = ""
+		}
+		if cur == nil {
+			if marker := fenceMarker(indented); marker != "" {
+				info := strings.Fields(indented[len(marker):])
+				cur = &codeBlock{}
+				if len(info) > 0 {
+					cur.lang = strings.ToLower(strings.Trim(info[0], "{}."))
+				}
+				fence = marker
+				body.Reset()
+			}
+			continue
+		}
+		if m := fenceMarker(indented); m != "" && m[0] == fence[0] && len(m) >= len(fence) && strings.TrimSpace(indented[len(m):]) == "" {
+			cur.content = body.String()
+			if strings.TrimSpace(cur.content) != "" {
+				blocks = append(blocks, *cur)
+			}
+			cur = nil
+			continue
+		}
+		body.WriteString(line)
+	}
+	if cur != nil && strings.TrimSpace(body.String()) != "" {
+		cur.content = body.String()
+		if !strings.HasSuffix(cur.content, "\n") {
+			cur.content += "\n"
+		}
+		blocks = append(blocks, *cur)
+	}
+	return blocks
+}
+
+// fenceMarker returns the run of three or more backticks or tildes line
+// starts with, or "".
+func fenceMarker(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
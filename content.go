@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// stripOptions control how file content is filtered line by line.
+type stripOptions struct {
+	commentsOnly  bool // invert comment stripping: keep comments, drop code
+	keepComments  bool // --strip-comments=false
+	keepBlank     bool // --strip-blank=false
+	maxLineRunes  int  // truncate longer lines (--truncate-long-lines); 0 = off
+	detectMarkers bool // pick comment markers per file (--comment-marker-detect)
+	trimTrailing  bool // drop trailing spaces and tabs (--trim-trailing-whitespace)
+	maxLines      int  // skip files with more raw lines (--max-line-count); 0 = off
+	dedent        bool // remove indentation common to every line (--dedent)
+	stripLogs     bool // drop single-line logging statements (--strip-logs)
+	trimEdges     bool // drop blank lines at the start and end of each file (--trim-file-edges)
+	redactStrings bool // blank out string literal contents (--redact-strings)
+
+	logPatterns []*regexp.Regexp // --strip-logs-pattern, for every file
+	lineFilters []*regexp.Regexp // drop lines matching any of these (--content-filter)
+	markers     []*regexp.Regexp // keep only matching files, bracketing the matches (--grep-mark)
+
+	reindent *reindentOptions // --reindent; applied per file, needs the path
+}
+
+// maxScanLine is the longest single line the scanner accepts. bufio's 64 KiB
+// default silently ends the scan on minified files, dropping the rest.
+const maxScanLine = 16 << 20
+
+// defaultCommentMarkers apply when a file's comment style isn't known.
+var defaultCommentMarkers = []string{"//", "#"}
+
+// stripContent drops blank lines and lines that start with a comment marker.
+// keepComments and keepBlank turn either half off independently. With
+// commentsOnly it keeps the comment lines and drops everything else. name
+// is the file's path, used by --comment-marker-detect. A leading shebang is
+// always kept: it is part of how the file runs, not a comment.
+func stripContent(r io.Reader, name string, opts stripOptions) string {
+	var sb strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxScanLine)
+	markers := defaultCommentMarkers
+	if opts.detectMarkers {
+		markers = nil
+	}
+	var logs logMatcher
+	if opts.stripLogs {
+		logs = newLogMatcher(name, opts.logPatterns)
+	}
+	logLines := 0
+	filtered := make([]int, len(opts.lineFilters))
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if first {
+			first = false
+			shebang := strings.HasPrefix(line, "#!")
+			if markers == nil {
+				markers = detectCommentMarkers(name, line)
+			}
+			if shebang {
+				sb.WriteString(line)
+				sb.WriteString("\n")
+				continue
+			}
+		}
+		if len(trimmed) == 0 {
+			if !opts.keepBlank {
+				continue
+			}
+		} else if opts.commentsOnly || !opts.keepComments {
+			if isCommentLine(trimmed, markers) != opts.commentsOnly {
+				continue
+			}
+		}
+		if logs != nil && logs.matches(trimmed) {
+			logLines++
+			continue
+		}
+		if i := matchingFilter(line, opts.lineFilters); i >= 0 {
+			filtered[i]++
+			continue
+		}
+		if opts.trimTrailing {
+			line = strings.TrimRight(line, " \t")
+		}
+		if opts.maxLineRunes > 0 {
+			line = truncateLine(line, opts.maxLineRunes)
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	if logLines > 0 {
+		verbosef("Stripped %d log line(s) from %s\n", logLines, name)
+	}
+	for i, n := range filtered {
+		if n > 0 {
+			verbosef("Dropped %d line(s) matching %s from %s\n", n, opts.lineFilters[i], name)
+		}
+	}
+	if opts.trimEdges {
+		return trimBlankEdges(sb.String())
+	}
+	return sb.String()
+}
+
+// trimBlankEdges removes whitespace-only lines from the start and end of s,
+// leaving the lines in between alone.
+func trimBlankEdges(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	start, end := 0, len(lines)
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	out := strings.Join(lines[start:end], "")
+	if out != "" && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out
+}
+
+// --grep-mark brackets. They are chosen to stand out from code: real source
+// almost never has either as a whole line.
+const (
+	grepMarkOpen  = ">>> match"
+	grepMarkClose = "<<< end match"
+)
+
+// markMatches wraps every run of consecutive lines matching any of patterns
+// in grepMarkOpen and grepMarkClose lines and returns how many runs it
+// bracketed. Nothing else in content changes.
+func markMatches(content string, patterns []*regexp.Regexp) (string, int) {
+	var sb strings.Builder
+	runs := 0
+	open := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line == "" {
+			continue
+		}
+		matched := matchingFilter(strings.TrimSuffix(line, "\n"), patterns) >= 0
+		if matched && !open {
+			sb.WriteString(grepMarkOpen + "\n")
+			runs++
+		} else if !matched && open {
+			sb.WriteString(grepMarkClose + "\n")
+		}
+		open = matched
+		sb.WriteString(line)
+	}
+	if open {
+		sb.WriteString(grepMarkClose + "\n")
+	}
+	return sb.String(), runs
+}
+
+// matchingFilter returns the index of the first pattern line matches, or -1.
+func matchingFilter(line string, patterns []*regexp.Regexp) int {
+	for i, re := range patterns {
+		if re.MatchString(line) {
+			return i
+		}
+	}
+	return -1
+}
+
+// detectCommentMarkers picks a file's comment markers from what
+// detectLanguage makes of it, falling back to the defaults.
+func detectCommentMarkers(name string, firstLine string) []string {
+	if m, ok := commentMarkers[detectLanguage(name, firstLine)]; ok {
+		return m
+	}
+	return defaultCommentMarkers
+}
+
+// isCommentLine reports whether an already-trimmed line starts with one of the
+// comment markers.
+func isCommentLine(trimmed string, markers []string) bool {
+	for _, m := range markers {
+		if strings.HasPrefix(trimmed, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateLine cuts line to max runes, noting how many were dropped. Counting
+// runes keeps multibyte characters intact.
+func truncateLine(line string, max int) string {
+	if utf8.RuneCountInString(line) <= max {
+		return line
+	}
+	runes := []rune(line)
+	return fmt.Sprintf("%s …(truncated %d chars)", string(runes[:max]), len(runes)-max)
+}
+
+// dedent removes the leading whitespace shared by every non-blank line, the
+// way Python's textwrap.dedent does. The shared prefix is compared byte for
+// byte, so a tab never cancels out spaces: with mixed indentation only the
+// part that really matches is removed (combine with --reindent to normalize
+// first).
+func dedent(content string) string {
+	lines := strings.SplitAfter(content, "\n")
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		body := strings.TrimLeft(line, " \t")
+		if body == "" || body == "\n" {
+			continue
+		}
+		lead := line[:len(line)-len(body)]
+		if first {
+			prefix, first = lead, false
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(lead) && prefix[n] == lead[n] {
+			n++
+		}
+		prefix = prefix[:n]
+		if prefix == "" {
+			return content
+		}
+	}
+	if prefix == "" {
+		return content
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.Join(lines, "")
+}
+
+// lineCounter counts the lines written through it. A final line without a
+// trailing newline still counts. It also counts the lines ending in CRLF, to
+// spot files that mix line endings.
+type lineCounter struct {
+	lines   int
+	crlf    int
+	partial bool
+	lastCR  bool // the previous write ended in '\r'
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := bytes.Count(p, []byte{'\n'})
+	c.lines += n
+	c.crlf += bytes.Count(p, []byte("\r\n"))
+	if c.lastCR && p[0] == '\n' {
+		c.crlf++
+	}
+	c.partial = p[len(p)-1] != '\n'
+	c.lastCR = p[len(p)-1] == '\r'
+	return len(p), nil
+}
+
+// mixedEndings reports whether both CRLF and bare LF line endings were seen.
+func (c *lineCounter) mixedEndings() bool {
+	return c.crlf > 0 && c.crlf < c.lines
+}
+
+func (c *lineCounter) count() int {
+	if c.partial {
+		return c.lines + 1
+	}
+	return c.lines
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripContentTrimTrailing(t *testing.T) {
+	in := "func f() {  \n\treturn 1\t \n}   \n"
+	tests := []struct {
+		trim bool
+		want string
+	}{
+		{false, in},
+		{true, "func f() {\n\treturn 1\n}\n"},
+	}
+	for _, tt := range tests {
+		got := stripContent(strings.NewReader(in), "f.go", stripOptions{trimTrailing: tt.trim})
+		if got != tt.want {
+			t.Errorf("trimTrailing=%v: got %q, want %q", tt.trim, got, tt.want)
+		}
+	}
+}
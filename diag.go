@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// quietMode suppresses warnings on stderr (--quiet).
+var quietMode bool
+
+// verboseMode adds progress details on stderr (--verbose).
+var verboseMode bool
+
+// jsonDiagnostics writes every diagnostic as one JSON object per line
+// (--error-format json) instead of free-form text.
+var jsonDiagnostics bool
+
+// Diagnostic levels, as they appear in --error-format json output.
+const (
+	levelError   = "error"
+	levelWarning = "warning"
+	levelInfo    = "info"
+)
+
+// diagnostic is one --error-format json line.
+type diagnostic struct {
+	Level   string `json:"level"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// logDiag is where every diagnostic ends up. text is the human-readable form;
+// with --error-format json, path and message are written as fields instead.
+// --quiet silences everything but errors.
+func logDiag(level string, path string, message string, text string) {
+	if quietMode && level != levelError {
+		return
+	}
+	if jsonDiagnostics {
+		b, _ := json.Marshal(diagnostic{Level: level, Path: path, Message: message})
+		fmt.Fprintln(os.Stderr, string(b))
+		return
+	}
+	fmt.Fprint(os.Stderr, text)
+}
+
+// warnf writes a warning to stderr unless --quiet was given.
+func warnf(format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	logDiag(levelWarning, "", diagMessage(text), text)
+}
+
+// infof writes a status note (not a problem) to stderr unless --quiet.
+func infof(format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	logDiag(levelInfo, "", diagMessage(text), text)
+}
+
+// verbosef writes a detail to stderr only with --verbose.
+func verbosef(format string, args ...any) {
+	if !verboseMode {
+		return
+	}
+	infof(format, args...)
+}
+
+// warnPath reports a problem with one path, such as a walk error or a file
+// that can't be opened, as "<action> <path>: <detail>".
+func warnPath(action string, path string, detail any) {
+	d := fmt.Sprint(detail)
+	logDiag(levelWarning, path, action+": "+d, fmt.Sprintf("%s %s: %s\n", action, path, d))
+}
+
+// fatal reports err and exits. Errors already carry their own "Error:"-style
+// prefix in text form. The path or URL is pulled out of wrapped filesystem and
+// HTTP errors for JSON output.
+func fatal(err error) {
+	path := ""
+	var pe *fs.PathError
+	var ue *url.Error
+	switch {
+	case errors.As(err, &pe):
+		path = pe.Path
+	case errors.As(err, &ue):
+		path = ue.URL
+	}
+	text := err.Error()
+	logDiag(levelError, path, diagMessage(text), text+"\n")
+	exit(1)
+}
+
+// diagMessage trims the text-only decoration off a message for JSON output.
+func diagMessage(text string) string {
+	text = strings.TrimSpace(text)
+	for _, p := range []string{"Error: ", "Warning: "} {
+		text = strings.TrimPrefix(text, p)
+	}
+	return text
+}
+
+func isValidErrorFormat(v string) bool {
+	return v == "text" || v == "json"
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// editorConfigs resolves .editorconfig properties for files. Parsed files are
+// cached by directory since every file in a tree consults the same ones; the
+// mutex makes it safe to use from the --workers pool.
+type editorConfigs struct {
+	mu    sync.Mutex
+	files map[string]*editorConfigFile // keyed by directory; nil = no file
+}
+
+type editorConfigFile struct {
+	dir      string
+	root     bool
+	sections []editorConfigSection
+}
+
+type editorConfigSection struct {
+	match *regexp.Regexp // matched against the slash path relative to dir
+	props map[string]string
+}
+
+func newEditorConfigs() *editorConfigs {
+	return &editorConfigs{files: make(map[string]*editorConfigFile)}
+}
+
+// properties returns the lowercase properties that apply to p. Files closer to
+// p override those further up, and the search stops at a file with root=true.
+func (ec *editorConfigs) properties(p string) map[string]string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil
+	}
+	var chain []*editorConfigFile
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if f := ec.load(dir); f != nil {
+			chain = append(chain, f)
+			if f.root {
+				break
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	props := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		f := chain[i]
+		rel, err := filepath.Rel(f.dir, abs)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, s := range f.sections {
+			if !s.match.MatchString(rel) {
+				continue
+			}
+			for k, v := range s.props {
+				props[k] = v
+			}
+		}
+	}
+	return props
+}
+
+func (ec *editorConfigs) load(dir string) *editorConfigFile {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if f, ok := ec.files[dir]; ok {
+		return f
+	}
+	f := parseEditorConfig(dir)
+	ec.files[dir] = f
+	return f
+}
+
+func parseEditorConfig(dir string) *editorConfigFile {
+	file, err := os.Open(filepath.Join(dir, ".editorconfig"))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	ec := &editorConfigFile{dir: dir}
+	var cur *editorConfigSection
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			re, err := regexp.Compile(editorConfigGlob(line[1 : len(line)-1]))
+			if err != nil {
+				cur = nil
+				continue
+			}
+			ec.sections = append(ec.sections, editorConfigSection{match: re, props: make(map[string]string)})
+			cur = &ec.sections[len(ec.sections)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.TrimSpace(value))
+		if cur == nil {
+			if key == "root" {
+				ec.root = value == "true"
+			}
+			continue
+		}
+		cur.props[key] = value
+	}
+	return ec
+}
+
+// editorConfigGlob translates an EditorConfig section glob into an anchored
+// regular expression. A glob without a slash matches at any depth.
+func editorConfigGlob(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		b.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case c == '{':
+			end := strings.IndexByte(glob[i:], '}')
+			if end > 0 {
+				if lo, hi, ok := numericRange(glob[i+1 : i+end]); ok {
+					b.WriteString("(?:")
+					for n := lo; n <= hi; n++ {
+						if n > lo {
+							b.WriteString("|")
+						}
+						b.WriteString(strconv.Itoa(n))
+					}
+					b.WriteString(")")
+					i += end
+					continue
+				}
+			}
+			braces++
+			b.WriteString("(?:")
+		case c == '}' && braces > 0:
+			braces--
+			b.WriteString(")")
+		case c == ',' && braces > 0:
+			b.WriteString("|")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// numericRange parses the "n1..n2" form of an EditorConfig brace.
+func numericRange(s string) (lo, hi int, ok bool) {
+	a, z, found := strings.Cut(s, "..")
+	if !found {
+		return 0, 0, false
+	}
+	lo, err1 := strconv.Atoi(a)
+	hi, err2 := strconv.Atoi(z)
+	if err1 != nil || err2 != nil || lo > hi {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
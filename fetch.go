@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchOptions are the href settings: HTTP (--timeout, --retries) and what to
+// do with HTML responses (--text, --readability).
+type fetchOptions struct {
+	timeout time.Duration
+	retries int // extra attempts after a network error, 429, or 5xx
+
+	text        bool // convert HTML responses to plain text
+	readability bool // with text: keep only the main content region
+	codeBlocks  bool // emit only a page's code samples, one section each
+	raw         bool // the body byte for byte, with no header or added newline
+
+	// --jq: filter JSON responses; passNonJSON copies other responses as they
+	// are instead of failing (--jq-non-json pass).
+	jq          *jqFilter
+	passNonJSON bool
+
+	// Pagination (--follow-next): after each page, fetch the page its Link
+	// header or <link rel="next"> points to, up to maxPages pages in all.
+	followNext bool
+	maxPages   int
+
+	// HTTP basic auth (--user). Kept out of every header line and message.
+	user     string
+	password string
+}
+
+var defaultFetchOptions = fetchOptions{timeout: 15 * time.Second, maxPages: 10}
+
+// do sends a request, retrying transient failures with a short linear backoff.
+// The caller closes the response body.
+func (o fetchOptions) do(method string, u string) (*http.Response, error) {
+	return o.send(method, u, nil, nil)
+}
+
+// send is do with a request body and extra headers, which are set after the
+// User-Agent and --user, so they take precedence. The body is resent on every
+// attempt.
+func (o fetchOptions) send(method string, u string, body []byte, header http.Header) (*http.Response, error) {
+	client := &http.Client{Timeout: o.timeout}
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= o.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		var req *http.Request
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err = http.NewRequest(method, u, r)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", githubUserAgent)
+		if o.user != "" {
+			req.SetBasicAuth(o.user, o.password)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if attempt < o.retries {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// setUser applies a curl-style --user value. Without a ":password" part the
+// password is prompted for on the terminal.
+func (o *fetchOptions) setUser(v string) error {
+	user, password, ok := strings.Cut(v, ":")
+	if user == "" {
+		return fmt.Errorf("Error: Invalid value for --user: missing user name")
+	}
+	if !ok {
+		p, err := readPassword(fmt.Sprintf("Enter host password for user '%s': ", user))
+		if err != nil {
+			return fmt.Errorf("Error: --user: %v", err)
+		}
+		password = p
+	}
+	o.user, o.password = user, password
+	return nil
+}
+
+var (
+	linkHeaderNext = regexp.MustCompile(`<([^>]*)>\s*;[^,]*\brel="?([^",;]*\s)?next(?:[\s",;]|$)`)
+	htmlLinkTag    = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	htmlRelNext    = regexp.MustCompile(`(?i)\brel\s*=\s*["']?([^"'>]*\s)?next[\s"'>/]`)
+	htmlHref       = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// nextPage finds the URL of the page after resp: the rel="next" entry of a
+// Link header, else an HTML <link rel="next">. It is resolved against the
+// response's final URL and returned as "" when there is none.
+func nextPage(resp *http.Response, body []byte, isHTML bool) string {
+	next := ""
+	for _, h := range resp.Header.Values("Link") {
+		if m := linkHeaderNext.FindStringSubmatch(h); m != nil {
+			next = m[1]
+			break
+		}
+	}
+	if next == "" && isHTML {
+		for _, tag := range htmlLinkTag.FindAllString(string(body), -1) {
+			if !htmlRelNext.MatchString(tag) {
+				continue
+			}
+			if m := htmlHref.FindStringSubmatch(tag); m != nil {
+				next = html.UnescapeString(m[1] + m[2] + m[3])
+				break
+			}
+		}
+	}
+	if next == "" {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(next))
+	if err != nil {
+		return ""
+	}
+	return resp.Request.URL.ResolveReference(ref).String()
+}
+
+// linkCheckConcurrency caps the requests in flight during href --check.
+const linkCheckConcurrency = 8
+
+type linkResult struct {
+	url    string
+	status int
+	final  string // URL after redirects, when different
+	err    error
+}
+
+func (r linkResult) dead() bool {
+	return r.err != nil || r.status >= 400
+}
+
+// checkLinks requests every URL concurrently and prints one line per URL, in
+// the order given. It reports whether all of them were alive.
+func checkLinks(urls []string, o fetchOptions) bool {
+	results := make([]linkResult, len(urls))
+	sem := make(chan struct{}, linkCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, raw := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = checkLink(u, o)
+		}(i, normalizeURL(raw))
+	}
+	wg.Wait()
+
+	ok := true
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			fmt.Printf("ERR %s: %v\n", r.url, r.err)
+		case r.final != "":
+			fmt.Printf("%d %s -> %s\n", r.status, r.url, r.final)
+		default:
+			fmt.Printf("%d %s\n", r.status, r.url)
+		}
+		if r.dead() {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkLink tries HEAD first and falls back to GET, since plenty of servers
+// reject or mishandle HEAD.
+func checkLink(u string, o fetchOptions) linkResult {
+	res := linkResult{url: u}
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		res.err = fmt.Errorf("not an http(s) URL")
+		return res
+	}
+	resp, err := o.do(http.MethodHead, u)
+	if err != nil || resp.StatusCode >= 400 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		resp, err = o.do(http.MethodGet, u)
+	}
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer resp.Body.Close()
+	res.status = resp.StatusCode
+	if final := resp.Request.URL.String(); final != u {
+		res.final = final
+	}
+	return res
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// binarySniffLen matches git's heuristic: a NUL byte in the first 8000 bytes
+// marks a file as binary.
+const binarySniffLen = 8000
+
+// localFilter decides which local paths make it into a pull.
+type localFilter struct {
+	repoRoot       string
+	ign            *gitignore.GitIgnore
+	includeIgnored bool
+	includeHidden  bool
+	includeVCS     bool // only honored together with includeIgnored
+	ignoreSymlinks bool
+	globalExcludes bool // also apply core.excludesFile
+
+	includeBinary      bool
+	respectBinaryAttrs bool
+	attrs              *gitAttributes
+
+	exts     map[string]bool      // normalized extensions to keep; empty keeps all
+	excludes *gitignore.GitIgnore // --exclude patterns; nil when none
+	includes *gitignore.GitIgnore // --include-from allowlist; nil when none
+	tests    string               // testsExclude or testsOnly; "" keeps test files like any other
+	order    []string             // filter layer order (--filter-order)
+
+	walked *walkRecord // non-nil records what a walk depends on (--cache)
+}
+
+// forStart returns a copy of f anchored on the repository that contains
+// startPath: its root, .gitignore, and (when enabled) .gitattributes.
+func (f *localFilter) forStart(startPath string) *localFilter {
+	root, ign := loadGitIgnoreFor(startPath, f.globalExcludes)
+	return f.withRepo(root, ign)
+}
+
+// forRoot returns a copy of f for a repository nested inside a walk, rooted at
+// dir. Its rules replace the outer repository's: git doesn't apply a parent
+// repo's .gitignore inside a nested repo either.
+func (f *localFilter) forRoot(dir string) *localFilter {
+	return f.withRepo(dir, compileRootGitIgnore(dir, f.globalExcludes))
+}
+
+func (f *localFilter) withRepo(root string, ign *gitignore.GitIgnore) *localFilter {
+	c := *f
+	c.repoRoot, c.ign = root, ign
+	c.attrs = nil
+	if c.respectBinaryAttrs {
+		c.attrs = loadGitAttributes(root)
+	}
+	c.noteRepoFiles()
+	return &c
+}
+
+// noteRepoFiles adds the files behind f's repository rules to the walk
+// record, if there is one.
+func (f *localFilter) noteRepoFiles() {
+	if f.walked == nil || f.repoRoot == "" {
+		return
+	}
+	f.walked.file(filepath.Join(f.repoRoot, ".gitignore"))
+	if f.respectBinaryAttrs {
+		f.walked.file(filepath.Join(f.repoRoot, ".gitattributes"))
+	}
+	if f.globalExcludes {
+		for _, p := range gitConfigFiles(f.repoRoot) {
+			f.walked.file(p)
+		}
+		if p := coreExcludesFile(f.repoRoot); p != "" {
+			f.walked.file(p)
+		}
+	}
+}
+
+// ignored reports whether p (file or directory) is excluded by .gitignore.
+func (f *localFilter) ignored(p string) bool {
+	return !f.includeIgnored && isIgnored(f.repoRoot, f.ign, p)
+}
+
+// hidden reports whether a walked entry should be skipped for being a dotfile
+// or dot-directory. Start paths are never hidden: naming one is an opt-in.
+func (f *localFilter) hidden(name string, isStart bool) bool {
+	if f.includeHidden || isStart {
+		return false
+	}
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// skipSymlink reports whether a walked entry should be skipped for being a
+// symlink (--ignore-symlinks). As with hidden files, start paths are exempt.
+func (f *localFilter) skipSymlink(d os.DirEntry, isStart bool) bool {
+	return f.ignoreSymlinks && !isStart && d.Type()&os.ModeSymlink != 0
+}
+
+// vcsDirs are version-control metadata directories. Walking them is slow on
+// large repos and never useful, so they are skipped even with --include-hidden.
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+// skipDir reports whether a walked directory is VCS metadata that should not be
+// descended into.
+func (f *localFilter) skipDir(name string, isStart bool) bool {
+	if isStart || (f.includeVCS && f.includeIgnored) {
+		return false
+	}
+	return vcsDirs[name]
+}
+
+// excluded reports whether p matches an --exclude pattern.
+func (f *localFilter) excluded(p string) bool {
+	return f.excludes != nil && f.excludes.MatchesPath(filepath.ToSlash(filepath.Clean(p)))
+}
+
+// included reports whether p matches the --include-from allowlist. Without
+// one, every path is included.
+func (f *localFilter) included(p string) bool {
+	return f.includes == nil || f.includes.MatchesPath(filepath.ToSlash(filepath.Clean(p)))
+}
+
+// pruneDir reports whether a walked directory should not be descended into.
+// As in git, a file inside an ignored or excluded directory can't be brought
+// back by a later layer, so directories are pruned regardless of
+// --filter-order.
+func (f *localFilter) pruneDir(p string) bool {
+	return f.ignored(p) || f.excluded(p)
+}
+
+// filterVote is one filter layer's opinion about a file.
+type filterVote int
+
+const (
+	voteAbstain filterVote = iota
+	voteInclude
+	voteExclude
+)
+
+// --exclude-tests and --only-tests.
+const (
+	testsExclude = "exclude"
+	testsOnly    = "only"
+)
+
+// defaultFilterOrder is the layer order when --filter-order is not given. In
+// it gitignore, exclude, include, and tests only ever vote to exclude, so it
+// keeps a file only when every layer allows it.
+var defaultFilterOrder = []string{"gitignore", "exclude", "include", "tests", "ext"}
+
+// filterLayers are the votes --filter-order can arrange. A layer abstains when
+// its flag isn't in use or it has nothing to say about the file.
+var filterLayers = map[string]func(f *localFilter, p string) filterVote{
+	"gitignore": func(f *localFilter, p string) filterVote {
+		if f.ignored(p) {
+			return voteExclude
+		}
+		return voteAbstain
+	},
+	"exclude": func(f *localFilter, p string) filterVote {
+		if f.excluded(p) {
+			return voteExclude
+		}
+		return voteAbstain
+	},
+	// include narrows: a match abstains, so an allowlisted file is still
+	// subject to gitignore. Ordered ahead of gitignore, a match votes to
+	// include instead, which brings an allowlisted gitignored file back.
+	"include": func(f *localFilter, p string) filterVote {
+		if !f.included(p) {
+			return voteExclude
+		}
+		if f.includes != nil && f.layerBefore("include", "gitignore") {
+			return voteInclude
+		}
+		return voteAbstain
+	},
+	"tests": func(f *localFilter, p string) filterVote {
+		if f.tests != "" && isTestFile(p) != (f.tests == testsOnly) {
+			return voteExclude
+		}
+		return voteAbstain
+	},
+	"ext": func(f *localFilter, p string) filterVote {
+		if len(f.exts) == 0 {
+			return voteAbstain
+		}
+		if f.exts[normalizeExt(filepath.Ext(p))] {
+			return voteInclude
+		}
+		return voteExclude
+	},
+}
+
+// parseFilterOrder validates a comma-separated --filter-order. Layers it leaves
+// out keep their default relative order after the listed ones.
+func parseFilterOrder(v string) ([]string, error) {
+	var order []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if filterLayers[name] == nil {
+			return nil, fmt.Errorf("Error: Invalid value for --filter-order: unknown layer %q (expected %s)", name, strings.Join(defaultFilterOrder, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Error: Invalid value for --filter-order: %q listed twice", name)
+		}
+		seen[name] = true
+		order = append(order, name)
+	}
+	for _, name := range defaultFilterOrder {
+		if !seen[name] {
+			order = append(order, name)
+		}
+	}
+	return order, nil
+}
+
+// allowFile applies the per-file checks that need more than the path's name.
+// The filter layers vote in order and the first one with an opinion decides;
+// when all abstain the file is kept. Binary detection runs after the layers
+// and can't be overridden by them.
+func (f *localFilter) allowFile(p string) bool {
+	order := f.order
+	if order == nil {
+		order = defaultFilterOrder
+	}
+	for _, name := range order {
+		vote := filterLayers[name](f, p)
+		if vote == voteExclude {
+			return false
+		}
+		if vote == voteInclude {
+			break
+		}
+	}
+	if !f.includeBinary && f.isBinary(p) {
+		return false
+	}
+	return true
+}
+
+// layerBefore reports whether layer a comes before layer b in f's filter order.
+func (f *localFilter) layerBefore(a string, b string) bool {
+	order := f.order
+	if order == nil {
+		order = defaultFilterOrder
+	}
+	for _, name := range order {
+		switch name {
+		case a:
+			return true
+		case b:
+			return false
+		}
+	}
+	return false
+}
+
+func (f *localFilter) setExts(exts []string) {
+	f.exts = nil
+	for _, e := range exts {
+		if f.exts == nil {
+			f.exts = make(map[string]bool)
+		}
+		f.exts[normalizeExt(e)] = true
+	}
+}
+
+// inferExtension returns the most common extension among the files the local
+// start paths would pull, breaking ties by first appearance. GitHub specs are
+// not consulted.
+func inferExtension(startPaths []string, f *localFilter) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, start := range startPaths {
+		if looksLikeGitHubSpec(start) {
+			continue
+		}
+		files, _ := collectLocalFiles(start, f.forStart(start))
+		for _, p := range files {
+			ext := normalizeExt(filepath.Ext(p))
+			if ext == "" {
+				continue
+			}
+			if counts[ext] == 0 {
+				order = append(order, ext)
+			}
+			counts[ext]++
+		}
+	}
+	best := ""
+	for _, ext := range order {
+		if counts[ext] > counts[best] {
+			best = ext
+		}
+	}
+	return best
+}
+
+func (f *localFilter) isBinary(p string) bool {
+	if f.respectBinaryAttrs {
+		if binary, known := f.attrs.isBinary(p); known {
+			return binary
+		}
+	}
+	// The verdict now depends on the file's contents, which can change
+	// without touching its directory's mtime.
+	if f.walked != nil {
+		f.walked.file(p)
+	}
+	return looksBinary(p)
+}
+
+func looksBinary(p string) bool {
+	file, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return bytes.IndexByte(buf[:n], 0) != -1
+}
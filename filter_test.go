@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// writeTree creates files (slash-separated paths relative to root) with the
+// given contents.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkSkipsGitDir(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".git/HEAD":          "ref: refs/heads/main\n",
+		".git/config":        "[core]\n",
+		".git/objects/ab/cd": "blob\n",
+		".env":               "KEY=1\n",
+		"main.go":            "package main\n",
+	})
+	for _, hidden := range []bool{false, true} {
+		f := (&localFilter{includeHidden: hidden}).forStart(root)
+		files, err := collectLocalFiles(root, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sawEnv := false
+		for _, p := range files {
+			if strings.Contains(filepath.ToSlash(p), "/.git/") {
+				t.Errorf("includeHidden=%v: walk returned %s", hidden, p)
+			}
+			sawEnv = sawEnv || filepath.Base(p) == ".env"
+		}
+		if sawEnv != hidden {
+			t.Errorf("includeHidden=%v: .env returned=%v", hidden, sawEnv)
+		}
+	}
+}
+
+func TestFilterOrder(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore": "gen.go\n",
+		"gen.go":     "package a\n",
+		"a_test.go":  "package a\n",
+		"main.go":    "package a\n",
+		"notes.md":   "# notes\n",
+	})
+	tests := []struct {
+		order string
+		want  map[string]bool
+	}{
+		{"", map[string]bool{"gen.go": false, "a_test.go": false, "main.go": true, "notes.md": false}},
+		{"ext,gitignore", map[string]bool{"gen.go": true, "a_test.go": true, "main.go": true, "notes.md": false}},
+		{"tests,ext", map[string]bool{"gen.go": true, "a_test.go": false, "main.go": true, "notes.md": false}},
+		{"gitignore,tests,ext", map[string]bool{"gen.go": false, "a_test.go": false, "main.go": true, "notes.md": false}},
+	}
+	for _, tt := range tests {
+		f := &localFilter{tests: testsExclude}
+		f.setExts([]string{"go"})
+		if tt.order != "" {
+			order, err := parseFilterOrder(tt.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.order = order
+		}
+		f = f.forStart(root)
+		for name, want := range tt.want {
+			if got := f.allowFile(filepath.Join(root, name)); got != want {
+				t.Errorf("--filter-order %q: allowFile(%s) = %v, want %v", tt.order, name, got, want)
+			}
+		}
+	}
+}
+
+func TestParseFilterOrder(t *testing.T) {
+	order, err := parseFilterOrder("Ext, gitignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ext,gitignore,exclude,include,tests"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("parseFilterOrder = %s, want %s", got, want)
+	}
+	for _, bad := range []string{"ext,nope", "ext,ext"} {
+		if _, err := parseFilterOrder(bad); err == nil {
+			t.Errorf("parseFilterOrder(%q) accepted", bad)
+		}
+	}
+}
+
+func TestForStartUsesTheStartPathsRepo(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoA := filepath.Join(tmp, "a")
+	repoB := filepath.Join(tmp, "b")
+	writeTree(t, tmp, map[string]string{
+		"a/.gitignore":   "*.txt\n",
+		"a/notes.txt":    "a\n",
+		"b/.git/HEAD":    "ref: refs/heads/main\n",
+		"b/.gitignore":   "*.log\n",
+		"b/src/keep.txt": "kept\n",
+		"b/src/app.log":  "ignored\n",
+		"b/src/main.go":  "package main\n",
+	})
+	t.Chdir(repoA)
+
+	start := filepath.Join(repoB, "src")
+	f := (&localFilter{}).forStart(start)
+	if f.repoRoot != repoB {
+		t.Fatalf("forStart(%s).repoRoot = %s, want %s", start, f.repoRoot, repoB)
+	}
+	files, err := collectLocalFiles(start, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range files {
+		names = append(names, filepath.Base(p))
+	}
+	if got, want := strings.Join(names, ","), "keep.txt,main.go"; got != want {
+		t.Errorf("pulled %s, want %s", got, want)
+	}
+}
+
+func TestIgnoreSymlinks(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{".gitignore": "", "real.go": "package a\n"})
+	link := filepath.Join(root, "link.go")
+	if err := os.Symlink(filepath.Join(root, "real.go"), link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	for _, ignore := range []bool{false, true} {
+		f := (&localFilter{ignoreSymlinks: ignore}).forStart(root)
+		files, err := collectLocalFiles(root, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range files {
+			names = append(names, filepath.Base(p))
+		}
+		want := "link.go,real.go"
+		if ignore {
+			want = "real.go"
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("ignoreSymlinks=%v: walked %s, want %s", ignore, got, want)
+		}
+	}
+
+	// Naming the link as a start path is an opt-in, as with hidden files.
+	f := (&localFilter{ignoreSymlinks: true}).forStart(link)
+	files, err := collectLocalFiles(link, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != link {
+		t.Errorf("start path %s gave %q", link, files)
+	}
+}
+
+func TestIncludeFromAgainstGitignore(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore": "secret.env\n",
+		"secret.env": "KEY=1\n",
+		"main.go":    "package a\n",
+	})
+	tests := []struct {
+		order          string
+		includeIgnored bool
+		want           map[string]bool
+	}{
+		{"", false, map[string]bool{"secret.env": false, "main.go": false}},
+		{"", true, map[string]bool{"secret.env": true, "main.go": false}},
+		{"include,gitignore", false, map[string]bool{"secret.env": true, "main.go": false}},
+	}
+	for _, tt := range tests {
+		f := &localFilter{includeIgnored: tt.includeIgnored}
+		f.includes = gitignore.CompileIgnoreLines("secret.env")
+		if tt.order != "" {
+			order, err := parseFilterOrder(tt.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.order = order
+		}
+		f = f.forStart(root)
+		for name, want := range tt.want {
+			if got := f.allowFile(filepath.Join(root, name)); got != want {
+				t.Errorf("order %q, includeIgnored=%v: allowFile(%s) = %v, want %v", tt.order, tt.includeIgnored, name, got, want)
+			}
+		}
+	}
+}
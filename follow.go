@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// --follow timing. The file is polled rather than watched, which works the
+// same on every OS and on network file systems. The clipboard is rewritten
+// once the file has been quiet for followDebounce, or at least every
+// followMaxWait while it keeps growing.
+const (
+	followPoll       = 250 * time.Millisecond
+	followDebounce   = 500 * time.Millisecond
+	followMaxWait    = 2 * time.Second
+	defaultFollowWin = 100
+)
+
+// tailWindow keeps the last n lines of a growing file. partial is the last
+// line while it has no newline yet.
+type tailWindow struct {
+	n       int
+	lines   []string
+	partial string
+}
+
+func (w *tailWindow) add(s string) {
+	s = w.partial + s
+	w.partial = ""
+	for s != "" {
+		line, rest, ok := strings.Cut(s, "\n")
+		if !ok {
+			w.partial = line
+			break
+		}
+		w.lines = append(w.lines, line+"\n")
+		s = rest
+	}
+	if len(w.lines) > w.n {
+		w.lines = append(w.lines[:0], w.lines[len(w.lines)-w.n:]...)
+	}
+}
+
+func (w *tailWindow) reset() {
+	w.lines = w.lines[:0]
+	w.partial = ""
+}
+
+// String returns the window; an unfinished last line counts as one of the n.
+func (w *tailWindow) String() string {
+	lines := w.lines
+	if w.partial != "" && len(lines) >= w.n {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "") + w.partial
+}
+
+// followFile mirrors the last n lines of p into the clipboard as the file
+// grows, like tail -f (--follow), until interrupted. A file that shrinks or
+// is replaced, as by log rotation, is read again from the start.
+func followFile(p string, n int) error {
+	if err := checkSandbox(p); err != nil {
+		return err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("Error: --follow: %v", err)
+	}
+	defer func() { f.Close() }()
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("Error: --follow: %v", err)
+	}
+	if st.IsDir() {
+		return fmt.Errorf("Error: --follow: %s is a directory", p)
+	}
+
+	win := &tailWindow{n: n}
+	offset, err := readTail(f, st.Size(), n, win)
+	if err != nil {
+		return fmt.Errorf("Error: --follow: %v", err)
+	}
+	copied := ""
+	flush := func() {
+		s := win.String()
+		if s == copied {
+			return
+		}
+		if err := writeClipboard(s); err != nil {
+			warnf("Warning: --follow: %v\n", err)
+			return
+		}
+		copied = s
+		verbosef("Copied the last %d line(s) of %s\n", strings.Count(s, "\n"), p)
+	}
+	flush()
+	infof("Following %s (last %d lines in the clipboard); press Ctrl-C to stop\n", p, n)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	ticker := time.NewTicker(followPoll)
+	defer ticker.Stop()
+
+	var changed, pending time.Time // last change, and first unflushed one
+	for {
+		select {
+		case <-stop:
+			flush()
+			infof("Stopped following %s\n", p)
+			return nil
+		case <-ticker.C:
+		}
+		if cur, err := os.Stat(p); err == nil && (!os.SameFile(cur, st) || cur.Size() < offset) {
+			// Rotated or truncated: start over on whatever is at p now.
+			if nf, err := os.Open(p); err == nil {
+				f.Close()
+				f, st, offset = nf, cur, 0
+				win.reset()
+				verbosef("%s was replaced or truncated; reading it from the start\n", p)
+			}
+		}
+		grown, err := readFrom(f, offset, win)
+		if err != nil {
+			return fmt.Errorf("Error: --follow: %v", err)
+		}
+		now := time.Now()
+		if grown > 0 {
+			offset += grown
+			changed = now
+			if pending.IsZero() {
+				pending = now
+			}
+		}
+		if !pending.IsZero() && (now.Sub(changed) >= followDebounce || now.Sub(pending) >= followMaxWait) {
+			flush()
+			pending = time.Time{}
+		}
+	}
+}
+
+// readTail loads the last n lines of a file of the given size into win by
+// reading backwards in chunks, so a long log isn't read in full. It returns
+// the offset to keep reading from.
+func readTail(f *os.File, size int64, n int, win *tailWindow) (int64, error) {
+	const chunk = 64 * 1024
+	start := size
+	newlines := 0
+	buf := make([]byte, chunk)
+	for start > 0 && newlines <= n {
+		step := int64(chunk)
+		if start < step {
+			step = start
+		}
+		start -= step
+		if _, err := f.ReadAt(buf[:step], start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		newlines += strings.Count(string(buf[:step]), "\n")
+	}
+	got, err := readFrom(f, start, win)
+	return start + got, err
+}
+
+// readFrom adds everything in f past offset to win and returns how many
+// bytes that was.
+func readFrom(f *os.File, offset int64, win *tailWindow) (int64, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	win.add(string(b))
+	return int64(len(b)), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// gistID returns the gist ID for gist.github.com/<user>/<id> or
+// gist.github.com/<id> URLs, and "" for anything else.
+func gistID(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil || pu.Host != "gist.github.com" {
+		return ""
+	}
+	segs := splitPathKeepOrder(pu.Path)
+	if len(segs) == 0 {
+		return ""
+	}
+	id := segs[len(segs)-1]
+	if len(segs) > 2 {
+		// gist.github.com/<user>/<id>/raw/... and friends.
+		id = segs[1]
+	}
+	return strings.TrimSuffix(id, ".git")
+}
+
+type ghGist struct {
+	Files map[string]struct {
+		Filename  string `json:"filename"`
+		Content   string `json:"content"`
+		Truncated bool   `json:"truncated"`
+		RawURL    string `json:"raw_url"`
+	} `json:"files"`
+}
+
+// fetchGistIntoBuilder emits every file of a gist under its own file: header,
+// in filename order.
+func fetchGistIntoBuilder(id string, out *emitter) error {
+	c := newGHClient()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/gists/%s", githubAPIRoot, url.PathEscape(id)), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("gist: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readUpTo(resp.Body, maxFetchBytes)
+	if err != nil {
+		return fmt.Errorf("gist: response too large for %s: %w", id, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if msg := extractGitHubMessage(body); msg != "" {
+			return fmt.Errorf("gist: %s (%s)", msg, resp.Status)
+		}
+		return fmt.Errorf("gist: bad status %s", resp.Status)
+	}
+
+	var g ghGist
+	if err := json.Unmarshal(body, &g); err != nil {
+		return fmt.Errorf("gist: decode failed: %w", err)
+	}
+
+	names := make([]string, 0, len(g.Files))
+	for name := range g.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := g.Files[name]
+		content := f.Content
+		if f.Truncated && f.RawURL != "" {
+			// The API inlines at most ~1 MB per file; fetch the rest raw.
+			raw, err := c.fetchRaw(f.RawURL)
+			if err != nil {
+				return err
+			}
+			content = raw
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		out.file(fileRecord{
+			Path:    fmt.Sprintf("gist.github.com/%s/%s", id, name),
+			RelPath: name,
+			Content: content,
+			Ext:     normalizeExt(path.Ext(name)),
+			header:  "file",
+		})
+	}
+	return nil
+}
+
+func (c *ghClient) fetchRaw(u string) (string, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("gist: raw fetch failed for %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("gist: raw fetch bad status for %s: %s", u, resp.Status)
+	}
+	b, err := readUpTo(resp.Body, maxFetchBytes)
+	if err != nil {
+		return "", fmt.Errorf("gist: file too large %s: %w", u, err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// gitAttributes holds the rules from a repository's root .gitattributes file.
+// Patterns use the same glob rules as .gitignore, so each one is compiled with
+// the gitignore matcher. Later rules override earlier ones, as in git.
+type gitAttributes struct {
+	root  string
+	rules []gitAttrRule
+}
+
+type gitAttrRule struct {
+	match *gitignore.GitIgnore
+	attrs map[string]string // "set", "unset", or an explicit value
+}
+
+func loadGitAttributes(repoRoot string) *gitAttributes {
+	if repoRoot == "" {
+		return nil
+	}
+	f, err := os.Open(filepath.Join(repoRoot, ".gitattributes"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	ga := &gitAttributes{root: repoRoot}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule := gitAttrRule{
+			match: gitignore.CompileIgnoreLines(fields[0]),
+			attrs: make(map[string]string),
+		}
+		for _, a := range fields[1:] {
+			switch {
+			case strings.HasPrefix(a, "-"):
+				rule.attrs[a[1:]] = "unset"
+			case strings.HasPrefix(a, "!"):
+				// "!attr" returns attr to unspecified; drop any earlier setting.
+				rule.attrs[a[1:]] = ""
+			case strings.Contains(a, "="):
+				kv := strings.SplitN(a, "=", 2)
+				rule.attrs[kv[0]] = kv[1]
+			default:
+				rule.attrs[a] = "set"
+			}
+		}
+		// "binary" is a built-in macro for "-diff -merge -text".
+		if rule.attrs["binary"] == "set" {
+			rule.attrs["diff"] = "unset"
+			rule.attrs["merge"] = "unset"
+			rule.attrs["text"] = "unset"
+		}
+		ga.rules = append(ga.rules, rule)
+	}
+	return ga
+}
+
+// lookup returns the state of attr for path p ("set", "unset", a value, or ""
+// when unspecified).
+func (ga *gitAttributes) lookup(p string, attr string) string {
+	if ga == nil {
+		return ""
+	}
+	rel, ok := repoRelPath(ga.root, p)
+	if !ok {
+		return ""
+	}
+	state := ""
+	for _, r := range ga.rules {
+		v, ok := r.attrs[attr]
+		if !ok || !r.match.MatchesPath(rel) {
+			continue
+		}
+		state = v
+	}
+	return state
+}
+
+// isBinary reports git's view of whether p is binary. known is false when
+// .gitattributes does not settle it: the text attribute is unspecified, or
+// set to a value such as "auto" that leaves the decision to content sniffing.
+func (ga *gitAttributes) isBinary(p string) (binary bool, known bool) {
+	switch ga.lookup(p, "text") {
+	case "unset":
+		return true, true
+	case "set":
+		return false, true
+	default:
+		return false, false
+	}
+}
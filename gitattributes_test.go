@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitAttributesIsBinary(t *testing.T) {
+	root := t.TempDir()
+	attrs := "* text=auto\n*.txt text\n*.png binary\n*.dat -text\n"
+	if err := os.WriteFile(filepath.Join(root, ".gitattributes"), []byte(attrs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ga := loadGitAttributes(root)
+
+	tests := []struct {
+		name   string
+		binary bool
+		known  bool
+	}{
+		{"main.go", false, false}, // text=auto falls back to sniffing
+		{"notes.txt", false, true},
+		{"logo.png", true, true},
+		{"blob.dat", true, true},
+	}
+	for _, tt := range tests {
+		binary, known := ga.isBinary(filepath.Join(root, tt.name))
+		if binary != tt.binary || known != tt.known {
+			t.Errorf("isBinary(%q) = (%v, %v), want (%v, %v)", tt.name, binary, known, tt.binary, tt.known)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitConfigValue looks up section.key (e.g. "core", "excludesfile") across git
+// config files, later files overriding earlier ones as git does. Only the
+// plain "key = value" form is understood; includes and subsections are
+// skipped. It returns "" when no file sets the key.
+func gitConfigValue(files []string, section string, key string) string {
+	value := ""
+	for _, p := range files {
+		if v, ok := readGitConfig(p, section, key); ok {
+			value = v
+		}
+	}
+	return value
+}
+
+func readGitConfig(p string, section string, key string) (string, bool) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	value, found := "", false
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "["), "]")
+			current = strings.ToLower(strings.TrimSpace(name))
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || current != section || !strings.EqualFold(strings.TrimSpace(k), key) {
+			continue
+		}
+		value, found = gitConfigString(strings.TrimSpace(v)), true
+	}
+	return value, found
+}
+
+// gitConfigString unquotes a config value and drops a trailing comment.
+func gitConfigString(v string) string {
+	if strings.HasPrefix(v, `"`) {
+		if end := strings.Index(v[1:], `"`); end >= 0 {
+			return strings.ReplaceAll(v[1:end+1], `\\`, `\`)
+		}
+	}
+	if i := strings.IndexAny(v, "#;"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v
+}
+
+// gitConfigFiles lists the config files git reads for the repository at root,
+// lowest priority first: the XDG config, ~/.gitconfig, then the repository's
+// own config (shared by every worktree of it).
+func gitConfigFiles(root string) []string {
+	var files []string
+	if xdg := xdgConfigHome(); xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+	if dir, ok := gitDir(root); ok {
+		if b, err := os.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+			common := strings.TrimSpace(string(b))
+			if !filepath.IsAbs(common) {
+				common = filepath.Join(dir, common)
+			}
+			dir = common
+		}
+		files = append(files, filepath.Join(dir, "config"))
+	}
+	return files
+}
+
+func xdgConfigHome() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return xdg
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config")
+	}
+	return ""
+}
+
+// coreExcludesFile returns the global excludes file for the repository at
+// root: core.excludesFile when set, otherwise git's default of
+// $XDG_CONFIG_HOME/git/ignore.
+func coreExcludesFile(root string) string {
+	p := gitConfigValue(gitConfigFiles(root), "core", "excludesfile")
+	if p == "" {
+		if xdg := xdgConfigHome(); xdg != "" {
+			return filepath.Join(xdg, "git", "ignore")
+		}
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, rest)
+		}
+	}
+	return p
+}
+
+// globalExcludeLines reads the patterns of the repository's global excludes
+// file, or nil when there is none.
+func globalExcludeLines(root string) []string {
+	p := coreExcludesFile(root)
+	if p == "" {
+		return nil
+	}
+	lines, err := readPatternFile(p)
+	if err != nil {
+		return nil
+	}
+	verbosef("Using global excludes from %s\n", p)
+	return lines
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Git selectors: which files gitFiles asks git for.
+const (
+	gitTracked   = "tracked"   // git ls-files (--git-tracked-only)
+	gitUntracked = "untracked" // untracked and not ignored (--untracked-only)
+	gitModified  = "modified"  // uncommitted changes, staged or not (--modified-only)
+)
+
+// gitSelectorFlags names the flag behind each selector, for messages.
+var gitSelectorFlags = map[string]string{
+	gitTracked:   "--git-tracked-only",
+	gitUntracked: "--untracked-only",
+	gitModified:  "--modified-only",
+}
+
+// gitFiles returns the files under startPath that git lists for selector,
+// instead of walking. Git has already decided what is ignored, so .gitignore
+// and hidden-file rules are skipped; --ext, --exclude, --include-from, the
+// test filters, --ignore-symlinks, and binary detection still apply. Listed
+// files missing from the work tree (deleted ones) and submodules are left
+// out.
+func gitFiles(startPath string, f *localFilter, selector string) ([]string, error) {
+	if f.repoRoot == "" {
+		return nil, fmt.Errorf("Error: %s needs a git repository, and %s is not in one", gitSelectorFlags[selector], startPath)
+	}
+	abs, err := filepath.Abs(startPath)
+	if err != nil {
+		return nil, err
+	}
+	relStart, err := filepath.Rel(f.repoRoot, abs)
+	if err != nil {
+		return nil, err
+	}
+	names, err := gitList(f.repoRoot, selector, filepath.ToSlash(relStart))
+	if err != nil {
+		return nil, err
+	}
+
+	c := *f
+	c.includeIgnored = true
+	var files []string
+	for _, name := range names {
+		rel, err := filepath.Rel(relStart, filepath.FromSlash(name))
+		if err != nil {
+			continue
+		}
+		p := filepath.Join(startPath, rel)
+		if lst, err := os.Lstat(p); err == nil && c.ignoreSymlinks && lst.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		st, err := os.Stat(p)
+		if err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		if c.allowFile(p) {
+			files = append(files, p)
+		}
+	}
+	verbosef("%s: %d file(s) under %s\n", gitSelectorFlags[selector], len(files), startPath)
+	return files, nil
+}
+
+// gitList runs git in root and returns the root-relative paths it lists for
+// selector, limited to pathspec.
+func gitList(root string, selector string, pathspec string) ([]string, error) {
+	// git status prints paths relative to the work-tree top level, which is
+	// not root when root is a subdirectory holding its own .gitignore.
+	top := ""
+	if selector == gitModified {
+		t, err := gitToplevel(root)
+		if err != nil {
+			return nil, err
+		}
+		top = t
+	}
+	args := []string{"-C", root, "ls-files", "-z"}
+	switch selector {
+	case gitUntracked:
+		args = append(args, "--others", "--exclude-standard")
+	case gitModified:
+		args = []string{"-C", root, "status", "--porcelain", "-z", "--untracked-files=no"}
+	}
+	cmd := exec.Command("git", append(args, "--", pathspec)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s", msg)
+		}
+		return nil, fmt.Errorf("Error: git %s failed in %s: %v", args[2], root, err)
+	}
+	fields := strings.Split(string(out), "\x00")
+	var names []string
+	for i := 0; i < len(fields); i++ {
+		name := fields[i]
+		if name == "" {
+			continue
+		}
+		if selector == gitModified {
+			// "XY path"; a rename or copy is followed by its old path.
+			if len(name) < 4 {
+				continue
+			}
+			if name[0] == 'R' || name[0] == 'C' {
+				i++
+			}
+			name = name[3:]
+			rel, ok := topRelToRoot(top, root, name)
+			if !ok {
+				continue
+			}
+			name = rel
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// gitToplevel returns the top level of the work tree containing dir.
+func gitToplevel(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s", msg)
+		}
+		return "", fmt.Errorf("Error: git rev-parse failed in %s: %v", dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// topRelToRoot turns name, relative to the work-tree top level, into a
+// slash-separated path relative to root. ok is false when name lies outside
+// root.
+func topRelToRoot(top string, root string, name string) (string, bool) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	// git reports the top level with symlinks resolved.
+	if resolved, err := filepath.EvalSymlinks(absRoot); err == nil {
+		absRoot = resolved
+	}
+	rel, err := filepath.Rel(absRoot, filepath.Join(top, filepath.FromSlash(name)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
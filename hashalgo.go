@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// hashAlgorithm is the digest used by the hash command, --manifest-out, and
+// --only-new (--hash-algo).
+var hashAlgorithm = "sha256"
+
+// hashAlgorithms are the --hash-algo values. "git" is git's blob object id, so
+// results can be compared with `git hash-object`.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"blake3": func() hash.Hash { return blake3.New(32, nil) },
+	"git":    func() hash.Hash { return &gitBlobHash{} },
+}
+
+func parseHashAlgo(v string) (string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if hashAlgorithms[v] != nil {
+		return v, nil
+	}
+	return "", fmt.Errorf("Error: Invalid value for --hash-algo: %q (expected sha256, sha1, blake3, or git)", v)
+}
+
+func newContentHash() hash.Hash {
+	return hashAlgorithms[hashAlgorithm]()
+}
+
+// gitBlobHash computes git's blob id: SHA-1 over "blob <len>\x00" followed by
+// the content. The length comes first, so the content is buffered until Sum.
+type gitBlobHash struct {
+	buf bytes.Buffer
+}
+
+func (g *gitBlobHash) Write(p []byte) (int, error) { return g.buf.Write(p) }
+func (g *gitBlobHash) Reset()                      { g.buf.Reset() }
+func (g *gitBlobHash) Size() int                   { return sha1.Size }
+func (g *gitBlobHash) BlockSize() int              { return sha1.BlockSize }
+
+func (g *gitBlobHash) Sum(b []byte) []byte {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", g.buf.Len())
+	h.Write(g.buf.Bytes())
+	return h.Sum(b)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// runHook runs a --pre-walk or --post-write command through the shell. Its
+// output goes to stderr so it never mixes with pulled content on stdout. If
+// the command fails, pull exits with the command's exit code.
+func runHook(flag string, command string) {
+	if command == "" {
+		return
+	}
+	verbosef("Running %s: %s\n", flag, command)
+	cmd := shellCommand(command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err == nil {
+		return
+	}
+	code := 1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		code = exitErr.ExitCode()
+	}
+	text := fmt.Sprintf("Error: %s command failed: %v", flag, err)
+	logDiag(levelError, "", diagMessage(text), text+"\n")
+	exit(code)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// HTML-to-text for href --text. This is deliberately a small regexp pass, not
+// a parser: it only has to turn documentation pages into readable context.
+var (
+	htmlNoise      = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|noscript|template|svg)\b[^>]*>.*?</(?:script|style|noscript|template|svg)\s*>`)
+	htmlBody       = regexp.MustCompile(`(?is)<body\b[^>]*>(.*)</body\s*>`)
+	htmlMain       = regexp.MustCompile(`(?is)<main\b[^>]*>(.*?)</main\s*>`)
+	htmlArticle    = regexp.MustCompile(`(?is)<article\b[^>]*>(.*?)</article\s*>`)
+	htmlChrome     = regexp.MustCompile(`(?is)<(nav|header|footer|aside|form)\b[^>]*>.*?</(?:nav|header|footer|aside|form)\s*>`)
+	htmlBreak      = regexp.MustCompile(`(?i)<br\s*/?>|</?(p|div|section|article|main|h[1-6]|li|ul|ol|tr|table|pre|blockquote|dt|dd|hr)\b[^>]*>`)
+	htmlTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlSpaces     = regexp.MustCompile(`[ \t\r\f\v]+`)
+	htmlBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// looksLikeHTML reports whether a response should go through --text, by its
+// Content-Type or, when that is missing, its first bytes.
+func looksLikeHTML(contentType string, body []byte) bool {
+	if contentType != "" {
+		return strings.Contains(strings.ToLower(contentType), "html")
+	}
+	head := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 512)])))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html")
+}
+
+// htmlToText strips scripts, styles, noscript blocks, and comments, then the
+// remaining tags. With readability it keeps only the <main> or <article>
+// region (dropping navigation chrome), falling back to the whole body.
+func htmlToText(src string, readability bool) string {
+	src = htmlNoise.ReplaceAllString(src, "")
+	if m := htmlBody.FindStringSubmatch(src); m != nil {
+		src = m[1]
+	}
+	if readability {
+		if m := htmlMain.FindStringSubmatch(src); m != nil {
+			src = m[1]
+		} else if m := htmlArticle.FindStringSubmatch(src); m != nil {
+			src = m[1]
+		} else {
+			src = htmlChrome.ReplaceAllString(src, "")
+		}
+	}
+	src = htmlBreak.ReplaceAllString(src, "\n")
+	src = htmlTag.ReplaceAllString(src, "")
+	src = html.UnescapeString(src)
+
+	lines := strings.Split(src, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(htmlSpaces.ReplaceAllString(l, " "))
+	}
+	text := strings.TrimSpace(htmlBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
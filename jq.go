@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/itchyny/gojq"
+)
+
+// jqFilter is a compiled --jq expression. Parsing and compiling happen when
+// the flag is parsed, so a bad filter is rejected before a request is made.
+// Results are printed the way jq prints them: one value per line, indented
+// by two spaces.
+type jqFilter struct {
+	src  string
+	code *gojq.Code
+}
+
+// errNotJSON means the response wasn't JSON, which --jq-non-json decides
+// about.
+var errNotJSON = errors.New("the response is not JSON")
+
+// jqNonJSON values.
+const (
+	jqNonJSONError = "error"
+	jqNonJSONPass  = "pass"
+)
+
+func compileJQ(src string) (*jqFilter, error) {
+	query, err := gojq.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return &jqFilter{src: src, code: code}, nil
+}
+
+// run applies the filter to every JSON value in body (a single document or
+// newline-delimited JSON) and returns the results, one per line.
+func (f *jqFilter) run(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var inputs []any
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errNotJSON
+		}
+		inputs = append(inputs, v)
+	}
+	if len(inputs) == 0 {
+		return nil, errNotJSON
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	for _, in := range inputs {
+		iter := f.code.Run(in)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				var halt *gojq.HaltError
+				if errors.As(err, &halt) && halt.Value() == nil {
+					break
+				}
+				return nil, err
+			}
+			if err := enc.Encode(v); err != nil {
+				return nil, fmt.Errorf("encoding a result: %w", err)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
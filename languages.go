@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// extAliases folds alternate spellings of an extension onto one canonical form
+// so filtering and language detection treat them as the same type.
+var extAliases = map[string]string{
+	".yml":      ".yaml",
+	".htm":      ".html",
+	".markdown": ".md",
+	".mkd":      ".md",
+	".jpeg":     ".jpg",
+}
+
+// normalizeExt turns "YML", "yml", or ".yml" into the canonical ".yaml". Every
+// extension comparison goes through here.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext == "" {
+		return ""
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if canon, ok := extAliases[ext]; ok {
+		return canon
+	}
+	return ext
+}
+
+// fenceLanguages maps normalized extensions to Markdown fence info strings.
+// Extensions not listed use the extension itself without the dot.
+var fenceLanguages = map[string]string{
+	".js":         "javascript",
+	".mjs":        "javascript",
+	".cjs":        "javascript",
+	".jsx":        "jsx",
+	".ts":         "typescript",
+	".tsx":        "tsx",
+	".py":         "python",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".sh":         "bash",
+	".bash":       "bash",
+	".zsh":        "zsh",
+	".md":         "markdown",
+	".h":          "c",
+	".hpp":        "cpp",
+	".cc":         "cpp",
+	".cs":         "csharp",
+	".kt":         "kotlin",
+	".mk":         "makefile",
+	".dockerfile": "dockerfile",
+	".bzl":        "starlark",
+}
+
+func fenceLanguage(ext string) string {
+	if lang, ok := fenceLanguages[ext]; ok {
+		return lang
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// commentMarkers are the line-comment prefixes of extensions whose comment
+// style --comment-marker-detect knows. Prose formats have none, so their #
+// headings survive. Unlisted extensions keep the default // and # markers.
+var commentMarkers = map[string][]string{
+	".go":         {"//"},
+	".js":         {"//"},
+	".mjs":        {"//"},
+	".cjs":        {"//"},
+	".jsx":        {"//"},
+	".ts":         {"//"},
+	".tsx":        {"//"},
+	".java":       {"//"},
+	".kt":         {"//"},
+	".swift":      {"//"},
+	".c":          {"//"},
+	".h":          {"//"},
+	".cpp":        {"//"},
+	".hpp":        {"//"},
+	".cc":         {"//"},
+	".cs":         {"//"},
+	".rs":         {"//"},
+	".php":        {"//", "#"},
+	".py":         {"#"},
+	".rb":         {"#"},
+	".sh":         {"#"},
+	".bash":       {"#"},
+	".zsh":        {"#"},
+	".fish":       {"#"},
+	".pl":         {"#"},
+	".r":          {"#"},
+	".yaml":       {"#"},
+	".toml":       {"#"},
+	".ps1":        {"#"},
+	".lua":        {"--"},
+	".sql":        {"--"},
+	".hs":         {"--"},
+	".mk":         {"#"},
+	".dockerfile": {"#"},
+	".cmake":      {"#"},
+	".bzl":        {"#"},
+	".groovy":     {"//"},
+	".el":         {";"},
+	".lisp":       {";"},
+	".txt":        {},
+	".md":         {},
+}
+
+// basenameExts gives well-known extensionless (or oddly named) files the
+// extension whose comment markers and fence language they use.
+var basenameExts = map[string]string{
+	"Makefile":       ".mk",
+	"makefile":       ".mk",
+	"GNUmakefile":    ".mk",
+	"Dockerfile":     ".dockerfile",
+	"Containerfile":  ".dockerfile",
+	"Gemfile":        ".rb",
+	"Rakefile":       ".rb",
+	"Guardfile":      ".rb",
+	"Podfile":        ".rb",
+	"Vagrantfile":    ".rb",
+	"Brewfile":       ".rb",
+	"Jenkinsfile":    ".groovy",
+	"CMakeLists.txt": ".cmake",
+	"BUILD":          ".bzl",
+	"WORKSPACE":      ".bzl",
+	".bashrc":        ".sh",
+	".bash_profile":  ".sh",
+	".profile":       ".sh",
+	".zshrc":         ".zsh",
+	"LICENSE":        ".txt",
+	"COPYING":        ".txt",
+	"README":         ".txt",
+}
+
+// basenameExt looks name up in basenameExts; "Dockerfile.dev" counts as a
+// Dockerfile.
+func basenameExt(name string) (string, bool) {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if ext, ok := basenameExts[base]; ok {
+		return ext, true
+	}
+	if strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+		return ".dockerfile", true
+	}
+	return "", false
+}
+
+// detectLanguage returns the extension a file should be treated as, from its
+// shebang or Emacs mode line, then its own extension when known, then its
+// base name. Otherwise it is the file's extension as is.
+func detectLanguage(name string, firstLine string) string {
+	lang := ""
+	if strings.HasPrefix(firstLine, "#!") {
+		lang = shebangInterpreter(firstLine)
+	} else {
+		lang = emacsMode(firstLine)
+	}
+	if ext, ok := interpreterExts[lang]; ok {
+		return ext
+	}
+	ext := normalizeExt(path.Ext(strings.ReplaceAll(name, "\\", "/")))
+	if _, ok := commentMarkers[ext]; ok {
+		return ext
+	}
+	if _, ok := fenceLanguages[ext]; ok {
+		return ext
+	}
+	if b, ok := basenameExt(name); ok {
+		return b
+	}
+	return ext
+}
+
+// interpreterExts maps shebang interpreters and Emacs major modes to the
+// extension whose comment markers they use.
+var interpreterExts = map[string]string{
+	"sh":           ".sh",
+	"bash":         ".sh",
+	"dash":         ".sh",
+	"ksh":          ".sh",
+	"zsh":          ".zsh",
+	"fish":         ".fish",
+	"shell-script": ".sh",
+	"python":       ".py",
+	"ruby":         ".rb",
+	"perl":         ".pl",
+	"php":          ".php",
+	"node":         ".js",
+	"deno":         ".ts",
+	"bun":          ".ts",
+	"js":           ".js",
+	"javascript":   ".js",
+	"typescript":   ".ts",
+	"lua":          ".lua",
+	"rscript":      ".r",
+	"pwsh":         ".ps1",
+	"emacs-lisp":   ".el",
+	"lisp":         ".lisp",
+	"c":            ".c",
+	"c++":          ".cpp",
+	"go":           ".go",
+	"rust":         ".rs",
+	"sql":          ".sql",
+	"yaml":         ".yaml",
+	"text":         ".txt",
+	"markdown":     ".md",
+}
+
+// shebangInterpreter returns the interpreter named by a "#!" line, looking
+// through /usr/bin/env and dropping version suffixes ("python3.11" -> "python").
+func shebangInterpreter(line string) string {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	name := path.Base(fields[0])
+	if name == "env" {
+		name = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				name = path.Base(f)
+				break
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimRight(name, "0123456789."))
+}
+
+// emacsMode returns the major mode from an Emacs "-*- mode: ruby -*-" or
+// "-*- ruby -*-" line, or "".
+func emacsMode(line string) string {
+	start := strings.Index(line, "-*-")
+	if start < 0 {
+		return ""
+	}
+	rest := line[start+3:]
+	end := strings.Index(rest, "-*-")
+	if end < 0 {
+		return ""
+	}
+	vars := strings.TrimSpace(rest[:end])
+	if !strings.Contains(vars, ":") {
+		return strings.ToLower(vars)
+	}
+	for _, v := range strings.Split(vars, ";") {
+		k, val, ok := strings.Cut(v, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "mode") {
+			return strings.ToLower(strings.TrimSpace(val))
+		}
+	}
+	return ""
+}
+
+// testFilePatterns are the base-name globs --exclude-tests and --only-tests use
+// to recognize test files, by language.
+var testFilePatterns = []struct {
+	lang  string
+	globs []string
+}{
+	{"Go", []string{"*_test.go"}},
+	{"JavaScript/TypeScript", []string{"*.test.js", "*.test.jsx", "*.test.mjs", "*.test.cjs", "*.test.ts", "*.test.tsx", "*.spec.js", "*.spec.jsx", "*.spec.mjs", "*.spec.cjs", "*.spec.ts", "*.spec.tsx"}},
+	{"Python", []string{"test_*.py", "*_test.py", "conftest.py"}},
+	{"Ruby", []string{"*_spec.rb", "*_test.rb", "test_*.rb"}},
+	{"Java", []string{"*Test.java", "*Tests.java", "*IT.java"}},
+	{"Kotlin", []string{"*Test.kt", "*Tests.kt"}},
+	{"C#", []string{"*Test.cs", "*Tests.cs"}},
+	{"PHP", []string{"*Test.php"}},
+	{"Swift", []string{"*Tests.swift"}},
+	{"Elixir", []string{"*_test.exs"}},
+}
+
+// testDirs hold only tests, whatever the file names inside (Jest's __tests__).
+var testDirs = []string{"__tests__"}
+
+// isTestFile reports whether p looks like a test file by name or location.
+func isTestFile(p string) bool {
+	p = strings.ReplaceAll(p, "\\", "/")
+	base := path.Base(p)
+	for _, lang := range testFilePatterns {
+		for _, g := range lang.globs {
+			if ok, _ := path.Match(g, base); ok {
+				return true
+			}
+		}
+	}
+	for _, d := range testDirs {
+		if strings.Contains("/"+path.Dir(p)+"/", "/"+d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// printLanguages writes the languages table (the languages command) straight
+// from the maps above, so it always matches what detection does.
+func printLanguages(w io.Writer) {
+	seen := make(map[string]bool)
+	var exts []string
+	for ext := range commentMarkers {
+		seen[ext] = true
+	}
+	for ext := range fenceLanguages {
+		seen[ext] = true
+	}
+	for ext := range seen {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	aliases := make(map[string][]string)
+	for alias, canon := range extAliases {
+		aliases[canon] = append(aliases[canon], alias)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EXT\tCOMMENTS\tFENCE\tALIASES")
+	for _, ext := range exts {
+		comments := strings.Join(defaultCommentMarkers, " ") + " (default)"
+		if m, ok := commentMarkers[ext]; ok {
+			comments = strings.Join(m, " ")
+			if comments == "" {
+				comments = "none"
+			}
+		}
+		a := aliases[ext]
+		sort.Strings(a)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ext, comments, fenceLanguage(ext), strings.Join(a, " "))
+	}
+	tw.Flush()
+
+	bases := make([]string, 0, len(basenameExts))
+	for name := range basenameExts {
+		bases = append(bases, name)
+	}
+	sort.Strings(bases)
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE NAME\tAS")
+	for _, name := range bases {
+		fmt.Fprintf(tw, "%s\t%s\n", name, basenameExts[name])
+	}
+	fmt.Fprintf(tw, "%s\t%s\n", "Dockerfile.*, *.dockerfile", ".dockerfile")
+	tw.Flush()
+
+	names := make([]string, 0, len(interpreterExts))
+	for name := range interpreterExts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SHEBANG/MODE\tAS")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", name, interpreterExts[name])
+	}
+	tw.Flush()
+}
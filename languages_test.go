@@ -0,0 +1,121 @@
+package main
+
+import "testing"
+
+func TestNormalizeExt(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"go", ".go"},
+		{".GO", ".go"},
+		{" yml ", ".yaml"},
+		{".YML", ".yaml"},
+		{"yaml", ".yaml"},
+		{".HTM", ".html"},
+		{"Markdown", ".md"},
+		{".mkd", ".md"},
+		{"JPEG", ".jpg"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeExt(tt.in); got != tt.want {
+			t.Errorf("normalizeExt(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguageExtensionCase(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"config.YML", ".yaml"},
+		{"config.yaml", ".yaml"},
+		{"index.HTM", ".html"},
+		{"README.Markdown", ".md"},
+		{"main.Go", ".go"},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.name, ""); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtFilterFoldsCaseAndAliases(t *testing.T) {
+	f := &localFilter{}
+	f.setExts([]string{"YML", "md"})
+	tests := []struct {
+		path string
+		want filterVote
+	}{
+		{"ci.yml", voteInclude},
+		{"ci.YAML", voteInclude},
+		{"NOTES.MARKDOWN", voteInclude},
+		{"main.go", voteExclude},
+	}
+	for _, tt := range tests {
+		if got := filterLayers["ext"](f, tt.path); got != tt.want {
+			t.Errorf("ext layer on %q = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguageShebangAndModeLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		firstLine string
+		want      string
+	}{
+		{"run", "#!/usr/bin/env python3", ".py"},
+		{"run", "#!/usr/bin/python3.11", ".py"},
+		{"run", "#!/usr/bin/env -S node --harmony", ".js"},
+		{"build", "#!/bin/bash -e", ".sh"},
+		{"Rakefile.local", "# -*- mode: ruby -*-", ".rb"},
+		{"init", "-- -*- lua -*-", ".lua"},
+		{"schema", "/* -*- Mode: SQL; indent-tabs-mode: nil -*- */", ".sql"},
+		{"script.txt", "#!/usr/bin/env ruby", ".rb"},
+		{"plain", "no hints here", ""},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.name, tt.firstLine); got != tt.want {
+			t.Errorf("detectLanguage(%q, %q) = %q, want %q", tt.name, tt.firstLine, got, tt.want)
+		}
+	}
+}
+
+func TestDetectCommentMarkers(t *testing.T) {
+	py := detectCommentMarkers("tool", "#!/usr/bin/env python3")
+	if !isCommentLine("# note", py) || isCommentLine("// not python", py) {
+		t.Errorf("python shebang markers = %q", py)
+	}
+	lua := detectCommentMarkers("init", "-- -*- mode: lua -*-")
+	if !isCommentLine("-- note", lua) {
+		t.Errorf("lua mode-line markers = %q", lua)
+	}
+}
+
+func TestDetectLanguageExtensionless(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  string
+		fence string
+	}{
+		{"Makefile", ".mk", "makefile"},
+		{"build/GNUmakefile", ".mk", "makefile"},
+		{"Dockerfile", ".dockerfile", "dockerfile"},
+		{"deploy/Dockerfile.dev", ".dockerfile", "dockerfile"},
+		{"Gemfile", ".rb", "ruby"},
+		{`ci\Jenkinsfile`, ".groovy", "groovy"},
+	}
+	for _, tt := range tests {
+		got := detectLanguage(tt.name, "")
+		if got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if fence := fenceLanguage(got); fence != tt.fence {
+			t.Errorf("fenceLanguage(%q) = %q, want %q", got, fence, tt.fence)
+		}
+	}
+}
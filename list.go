@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// listOptions shape the output of the list command.
+type listOptions struct {
+	null  bool   // end entries with NUL instead of newline (--null), for xargs -0
+	sizes bool   // put the size in bytes and a tab before each path (--sizes)
+	style string // --path-style
+}
+
+// writeListEntry writes one line of list output. A file that can't be
+// stat'ed for --sizes is listed with size -1 rather than dropped, since the
+// walk did select it.
+func writeListEntry(w io.Writer, p string, opts listOptions) {
+	shown := styledPath(p, opts.style)
+	if opts.sizes {
+		size := int64(-1)
+		if st, err := os.Stat(p); err == nil {
+			size = st.Size()
+		}
+		shown = fmt.Sprintf("%d\t%s", size, shown)
+	}
+	end := "\n"
+	if opts.null {
+		end = "\x00"
+	}
+	io.WriteString(w, shown+end)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+)
+
+// logPatterns match the start of a trimmed line that is a logging or debug
+// print statement (--strip-logs), by normalized extension.
+var logPatterns = map[string][]*regexp.Regexp{
+	".go":   {regexp.MustCompile(`^(log|slog)\.\w+\(`), regexp.MustCompile(`^fmt\.(Print|Fprint)\w*\(`)},
+	".js":   {regexp.MustCompile(`^console\.\w+\(`)},
+	".py":   {regexp.MustCompile(`^(print|logging\.\w+|logger\.\w+|log\.\w+)\(`)},
+	".rb":   {regexp.MustCompile(`^(puts|pp|p)[\s(]`), regexp.MustCompile(`^(Rails\.)?logger\.\w+[\s(]`)},
+	".rs":   {regexp.MustCompile(`^(println|eprintln|print|eprint|dbg)!\(`), regexp.MustCompile(`^(log::)?(trace|debug|info|warn|error)!\(`)},
+	".java": {regexp.MustCompile(`^System\.(out|err)\.print\w*\(`), regexp.MustCompile(`^(log|logger|LOG|LOGGER)\.\w+\(`)},
+	".php":  {regexp.MustCompile(`^(var_dump|print_r|error_log)\(`)},
+}
+
+func init() {
+	for _, ext := range []string{".mjs", ".cjs", ".jsx", ".ts", ".tsx"} {
+		logPatterns[ext] = logPatterns[".js"]
+	}
+	logPatterns[".kt"] = logPatterns[".java"]
+}
+
+// logMatcher holds the log patterns that apply to one file: its language's
+// built-ins plus any --strip-logs-pattern regexps.
+type logMatcher []*regexp.Regexp
+
+func newLogMatcher(name string, extra []*regexp.Regexp) logMatcher {
+	m := append(logMatcher{}, logPatterns[normalizeExt(filepath.Ext(name))]...)
+	return append(m, extra...)
+}
+
+// matches reports whether an already-trimmed line is a complete log
+// statement. A line whose parentheses don't balance is the start (or end) of
+// a call spanning several lines and is kept, since dropping only part of it
+// would leave broken code behind.
+func (m logMatcher) matches(trimmed string) bool {
+	for _, re := range m {
+		if re.MatchString(trimmed) {
+			return balancedParens(trimmed)
+		}
+	}
+	return false
+}
+
+// balancedParens reports whether the parentheses in s outside of string
+// literals balance.
+func balancedParens(s string) bool {
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		}
+	}
+	return depth == 0 && quote == 0
+}
@@ -3,27 +3,31 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/atotto/clipboard"
 	gitignore "github.com/sabhiram/go-gitignore"
 )
 
 const (
 	maxFetchBytes   = 5 << 20 // 5 MiB (href + github file fetch safety limit)
+	defaultWarnSize = 1 << 20 // 1 MiB (--warn-size)
 	githubAPIRoot   = "https://api.github.com"
 	githubAPIVer    = "2022-11-28"
 	githubUserAgent = "pull/1.0 (+clipboard)"
@@ -40,17 +44,110 @@ func main() {
 	var filePaths []string
 	appendMode := false
 	prependMode := false
+	strictMode := false
+	dedupeAppend := false
+	fromClipboard := false
 	includeIgnored := false
+	includeBinary := false
+	includeHidden := false
+	includeVCS := false
+	respectBinaryAttrs := false
+	respectExcludesFile := false
+	tests := ""
+	var exts []string
+	inferExt := false
+	includeEmpty := false
+	squashHeaders := false
+	noHeader := false
+	fileSeparator := ""
+	mergeSmall := 0
+	wrapCols := 0
+	wrapAll := false
+	workers := 1
+	countMode := false
+	countPerFile := false
+	countOnly := false
+	estimateCost := false
+	var split splitOptions
+	envExpand := false
+	ignoreSymlinks := false
+	prependTree := false
+	failOnEmpty := ""
+	appendSummary := false
+	respectEditorConfig := false
+	var excludes []string
+	var includeFiles []string
+	register := ""
+	cpuProfile, memProfile := "", ""
+	chdir := ""
+	var filterOrder []string
+	useCache, refreshCache, noCache := false, false, false
+	gitSelect := ""
+	dedupeContent := false
+	preWalk, postWrite := "", ""
+	skipOutliers := 0.0
+	fetch := defaultFetchOptions
+	fetchUser := ""
+	linkCheck := false
+	summaryMode := false
+	var summary summaryOptions
+	tokenModel := ""
+	var strip stripOptions
 	sampleMode := false
 	sampleMin := 2
 	sampleMax := 3
 	sampleMinSet := false
 	sampleMaxSet := false
+	groupByDir := false
+	dirOrder := "alpha"
+	var dirPriority []string
+	groupByExt := false
+	resolveSymlinks := false
+	sandboxDir := ""
+	followPath := ""
+	jqNonJSON := ""
+	followLines := 0
+	var extOrder []string
 	command := ""
 	writeTarget := ""
+	selection := ""
+	outTarget := ""
+	toStdout := false
+	format := ""
+	jsonIndent := -1
+	pathStyle := pathPosix
+	templatePath := ""
+	assumeYes := false
+	warnSize := int64(defaultWarnSize)
+	onConflict := conflictOverwrite
+	newFileMode := os.FileMode(0644)
+	onlyNew := ""
+	clipType := ""
+	retryClipboard := false
+	asciiMode := ""
+	normalizeQuotes := false
+	var list listOptions
+	normalize := ""
+	manifestOut := ""
 
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
+		if v, ok := boolFlag(arg, "--strip-comments"); ok {
+			strip.keepComments = !v
+			continue
+		}
+		if v, ok := boolFlag(arg, "--strip-blank"); ok {
+			strip.keepBlank = !v
+			continue
+		}
+		if v, ok := boolFlag(arg, "--progress-json"); ok {
+			progressJSON = v
+			continue
+		}
+		if v, ok := boolFlag(arg, "--retry-clipboard"); ok {
+			retryClipboard = v
+			continue
+		}
 		switch arg {
 		case "--append":
 			appendMode = true
@@ -58,64 +155,615 @@ func main() {
 		case "--prepend":
 			prependMode = true
 			continue
+		case "--stdout":
+			toStdout = true
+			continue
+		case "--from-clipboard":
+			fromClipboard = true
+			continue
+		case "--dedupe-append":
+			dedupeAppend = true
+			appendMode = true
+			continue
+		case "--strict":
+			strictMode = true
+			continue
+		case "--quiet", "-q":
+			quietMode = true
+			continue
+		case "--verbose", "-v":
+			verboseMode = true
+			continue
+		case "--null", "-0":
+			list.null = true
+			continue
+		case "--sizes":
+			list.sizes = true
+			continue
+		case "--normalize-quotes":
+			normalizeQuotes = true
+			continue
+		case "--ascii-only":
+			if asciiMode == "" {
+				asciiMode = asciiReplace
+			}
+			continue
+		case "--fail-on-empty":
+			if failOnEmpty == "" {
+				failOnEmpty = emptyContent
+			}
+			continue
+		case "--dedent":
+			strip.dedent = true
+			continue
+		case "--prepend-tree":
+			prependTree = true
+			continue
+		case "--append-summary":
+			appendSummary = true
+			continue
+		case "--ignore-symlinks":
+			ignoreSymlinks = true
+			continue
+		case "--env-expand":
+			envExpand = true
+			continue
 		case "--includeIgnore":
 			includeIgnored = true
 			continue
+		case "--include-hidden":
+			includeHidden = true
+			continue
+		case "--include-vcs":
+			includeVCS = true
+			continue
+		case "--include-binary":
+			includeBinary = true
+			continue
+		case "--respect-binary-gitattributes":
+			respectBinaryAttrs = true
+			continue
+		case "--exclude-tests":
+			tests = testsExclude
+			continue
+		case "--only-tests":
+			tests = testsOnly
+			continue
+		case "--respect-core-excludesfile-config":
+			respectExcludesFile = true
+			continue
 		case "--sample":
 			sampleMode = true
 			continue
-		case "--sample-min":
-			if i+1 >= len(args) {
-				fmt.Println("Error: Missing value for --sample-min")
-				os.Exit(1)
+		case "--json-pretty":
+			if jsonIndent < 0 {
+				jsonIndent = 2
+			}
+			continue
+		case "--dedupe-content":
+			dedupeContent = true
+			continue
+		case "--git-tracked-only", "--include-git-tracked-only", "--untracked-only", "--modified-only":
+			selector := gitTracked
+			switch arg {
+			case "--untracked-only":
+				selector = gitUntracked
+			case "--modified-only":
+				selector = gitModified
+			}
+			if gitSelect != "" && gitSelect != selector {
+				fmt.Printf("Error: %s and %s can't be combined\n", gitSelectorFlags[gitSelect], gitSelectorFlags[selector])
+				exit(1)
 			}
-			v, err := parseSampleValue(args[i+1], "--sample-min")
+			gitSelect = selector
+			continue
+		case "--respect-gitignore-cache", "--cache":
+			useCache = true
+			continue
+		case "--refresh":
+			useCache, refreshCache = true, true
+			continue
+		case "--no-cache":
+			noCache = true
+			continue
+		case "--resolve-symlinks":
+			resolveSymlinks = true
+			continue
+		case "--group-by-ext":
+			groupByExt = true
+			continue
+		case "--group-by-dir":
+			groupByDir = true
+			continue
+		case "--comments-only":
+			strip.commentsOnly = true
+			continue
+		case "--redact-strings", "--strip-string-literals":
+			strip.redactStrings = true
+			continue
+		case "--trim-file-edges", "--strip-blank-at-edges":
+			strip.trimEdges = true
+			continue
+		case "--trim-trailing-whitespace":
+			strip.trimTrailing = true
+			continue
+		case "--wrap-all":
+			wrapAll = true
+			continue
+		case "--strip-logs":
+			strip.stripLogs = true
+			continue
+		case "--comment-marker-detect", "--detect-language-from-content":
+			strip.detectMarkers = true
+			continue
+		case "--summarize", "--summary-only":
+			summaryMode = true
+			continue
+		case "--text":
+			fetch.text = true
+			continue
+		case "--raw":
+			fetch.raw = true
+			continue
+		case "--code-blocks":
+			fetch.codeBlocks = true
+			continue
+		case "--readability":
+			fetch.text = true
+			fetch.readability = true
+			continue
+		case "--follow-next":
+			fetch.followNext = true
+			continue
+		case "--check", "--link-check":
+			linkCheck = true
+			continue
+		case "--respect-editorconfig":
+			respectEditorConfig = true
+			continue
+		case "--interactive-split":
+			split.interactive = true
+			continue
+		case "--count":
+			countMode = true
+			continue
+		case "--estimate-cost":
+			estimateCost = true
+			continue
+		case "--count-per-file":
+			countPerFile = true
+			continue
+		case "--count-only":
+			countOnly = true
+			continue
+		case "--squash-headers":
+			squashHeaders = true
+			continue
+		case "--no-header":
+			noHeader = true
+			continue
+		case "--include-empty":
+			includeEmpty = true
+			continue
+		case "--infer-ext":
+			inferExt = true
+			continue
+		case "--yes", "-y":
+			assumeYes = true
+			continue
+		}
+
+		if v, ok := flagValue(args, &i, "--sample-min"); ok {
+			n, err := parseSampleValue(v, "--sample-min")
 			if err != nil {
 				fmt.Println(err.Error())
-				os.Exit(1)
+				exit(1)
 			}
-			sampleMin = v
+			sampleMin = n
 			sampleMinSet = true
 			sampleMode = true
-			i++
 			continue
-		case "--sample-max":
-			if i+1 >= len(args) {
-				fmt.Println("Error: Missing value for --sample-max")
-				os.Exit(1)
-			}
-			v, err := parseSampleValue(args[i+1], "--sample-max")
+		}
+		if v, ok := flagValue(args, &i, "--sample-max"); ok {
+			n, err := parseSampleValue(v, "--sample-max")
 			if err != nil {
 				fmt.Println(err.Error())
-				os.Exit(1)
+				exit(1)
 			}
-			sampleMax = v
+			sampleMax = n
 			sampleMaxSet = true
 			sampleMode = true
-			i++
 			continue
 		}
-
-		if strings.HasPrefix(arg, "--sample-min=") {
-			v, err := parseSampleValue(strings.TrimPrefix(arg, "--sample-min="), "--sample-min")
+		if v, ok := flagValue(args, &i, "--skip-outliers"); ok {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || n <= 1 {
+				fmt.Printf("Error: Invalid value for --skip-outliers: %q (expected a multiple of the median greater than 1)\n", v)
+				exit(1)
+			}
+			skipOutliers = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--workers"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --workers: %q\n", v)
+				exit(1)
+			}
+			workers = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--truncate-long-lines"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --truncate-long-lines: %q\n", v)
+				exit(1)
+			}
+			strip.maxLineRunes = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--summary-base-url"); ok {
+			summary.baseURL = v
+			summaryMode = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--summary-model"); ok {
+			summary.model = v
+			summaryMode = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--summary-prompt"); ok {
+			summary.prompt = v
+			summaryMode = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--timeout"); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(v))
+			if err != nil || d <= 0 {
+				fmt.Printf("Error: Invalid value for --timeout: %q (expected a duration such as 10s)\n", v)
+				exit(1)
+			}
+			fetch.timeout = d
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--wrap"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --wrap: %q\n", v)
+				exit(1)
+			}
+			wrapCols = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--strip-logs-pattern"); ok {
+			re, err := regexp.Compile(v)
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(1)
+				fmt.Printf("Error: Invalid value for --strip-logs-pattern: %v\n", err)
+				exit(1)
 			}
-			sampleMin = v
-			sampleMinSet = true
-			sampleMode = true
+			strip.logPatterns = append(strip.logPatterns, re)
+			strip.stripLogs = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--pre-walk"); ok {
+			preWalk = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--post-write"); ok {
+			postWrite = v
 			continue
 		}
-		if strings.HasPrefix(arg, "--sample-max=") {
-			v, err := parseSampleValue(strings.TrimPrefix(arg, "--sample-max="), "--sample-max")
+		if v, ok := flagValue(args, &i, "--content-filter"); ok {
+			re, err := regexp.Compile(v)
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(1)
+				fmt.Printf("Error: Invalid value for --content-filter: %v\n", err)
+				exit(1)
 			}
-			sampleMax = v
-			sampleMaxSet = true
-			sampleMode = true
+			strip.lineFilters = append(strip.lineFilters, re)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--grep-mark"); ok {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				fmt.Printf("Error: Invalid value for --grep-mark: %v\n", err)
+				exit(1)
+			}
+			strip.markers = append(strip.markers, re)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--merge-adjacent"); ok {
+			n, err := parseSize(v)
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --merge-adjacent: %q (expected a size such as 512 or 2k)\n", v)
+				exit(1)
+			}
+			mergeSmall = int(n)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--max-pages"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --max-pages: %q\n", v)
+				exit(1)
+			}
+			fetch.maxPages = n
+			fetch.followNext = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--clipboard-timeout"); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(v))
+			if err != nil || d < 0 {
+				fmt.Printf("Error: Invalid value for --clipboard-timeout: %q (expected a duration such as 10s, or 0 for none)\n", v)
+				exit(1)
+			}
+			clipboardTimeout = d
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--retries"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 0 {
+				fmt.Printf("Error: Invalid value for --retries: %q\n", v)
+				exit(1)
+			}
+			fetch.retries = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--exclude"); ok {
+			excludes = append(excludes, v)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--include-from"); ok {
+			includeFiles = append(includeFiles, v)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--profile"); ok {
+			cpuProfile = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--memprofile"); ok {
+			memProfile = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--hash-algo"); ok {
+			algo, err := parseHashAlgo(v)
+			if err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			hashAlgorithm = algo
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--register"); ok {
+			if _, err := registerPath(v); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			register = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--user"); ok {
+			fetchUser = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--chdir"); ok {
+			chdir = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--filter-order"); ok {
+			order, err := parseFilterOrder(v)
+			if err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			filterOrder = order
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--reindent"); ok {
+			r, err := parseReindent(v)
+			if err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			strip.reindent = r
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--warn-size"); ok {
+			n, err := parseSize(v)
+			if err != nil || n < 0 {
+				fmt.Printf("Error: Invalid value for --warn-size: %q (expected a size such as 512k or 2M, or 0 to turn it off)\n", v)
+				exit(1)
+			}
+			warnSize = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--split-by-size"); ok {
+			n, err := parseSize(v)
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --split-by-size: %q\n", v)
+				exit(1)
+			}
+			split.maxBytes = int(n)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--split-by-tokens"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --split-by-tokens: %q\n", v)
+				exit(1)
+			}
+			split.maxTokens = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--count-tokens-model"); ok {
+			tokenModel = v
+			countMode = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--model"); ok {
+			tokenModel = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--ext"); ok {
+			exts = append(exts, splitList(v)...)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--format"); ok {
+			format = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--file-separator"); ok {
+			fileSeparator = unescapeSeparator(v)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--path-style"); ok {
+			switch v {
+			case pathPosix, pathWindows, pathNative:
+				pathStyle = v
+			default:
+				fmt.Printf("Error: Invalid value for --path-style: %q (expected posix, windows, or native)\n", v)
+				exit(1)
+			}
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--json-indent"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 0 || n > 16 {
+				fmt.Printf("Error: Invalid value for --json-indent: %q (expected 0-16 spaces)\n", v)
+				exit(1)
+			}
+			jsonIndent = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--template"); ok {
+			templatePath = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--out"); ok {
+			outTarget = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--selection"); ok {
+			selection = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--dir-order"); ok {
+			dirOrder = v
+			groupByDir = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--fail-on-empty-mode"); ok {
+			if v != emptyContent && v != emptyMatched {
+				fmt.Printf("Error: Invalid value for --fail-on-empty-mode: %q (expected content or matched)\n", v)
+				exit(1)
+			}
+			failOnEmpty = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--max-line-count"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --max-line-count: %q\n", v)
+				exit(1)
+			}
+			strip.maxLines = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--normalize-unicode"); ok {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if _, ok := normalizationForms[v]; !ok {
+				fmt.Printf("Error: Invalid value for --normalize-unicode: %q (expected nfc, nfd, nfkc, or nfkd)\n", v)
+				exit(1)
+			}
+			normalize = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--ascii-mode"); ok {
+			if !isValidASCIIMode(v) {
+				fmt.Printf("Error: Invalid value for --ascii-mode: %q (expected replace, strip, or report)\n", v)
+				exit(1)
+			}
+			asciiMode = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--clip-type"); ok {
+			clipType = strings.TrimSpace(v)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--mode"); ok {
+			n, err := strconv.ParseUint(strings.TrimSpace(v), 8, 32)
+			if err != nil || n > 0777 {
+				fmt.Printf("Error: Invalid value for --mode: %q (expected octal permissions such as 0755)\n", v)
+				exit(1)
+			}
+			newFileMode = os.FileMode(n)
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--only-new"); ok {
+			onlyNew = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--manifest-out"); ok {
+			manifestOut = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--error-format"); ok {
+			if !isValidErrorFormat(v) {
+				fmt.Printf("Error: Invalid value for --error-format: %q (expected text or json)\n", v)
+				exit(1)
+			}
+			jsonDiagnostics = v == "json"
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--on-conflict"); ok {
+			if !isValidConflictPolicy(v) {
+				fmt.Printf("Error: Invalid value for --on-conflict: %q (expected overwrite, skip, rename, or prompt)\n", v)
+				exit(1)
+			}
+			onConflict = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--jq"); ok {
+			f, err := compileJQ(v)
+			if err != nil {
+				fmt.Printf("Error: Invalid value for --jq: %v\n", err)
+				exit(1)
+			}
+			fetch.jq = f
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--jq-non-json"); ok {
+			if v != jqNonJSONError && v != jqNonJSONPass {
+				fmt.Printf("Error: Invalid value for --jq-non-json: %q (expected error or pass)\n", v)
+				exit(1)
+			}
+			jqNonJSON = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--follow"); ok {
+			followPath = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--lines"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 1 {
+				fmt.Printf("Error: Invalid value for --lines: %q\n", v)
+				exit(1)
+			}
+			followLines = n
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--sandbox-root"); ok {
+			sandboxDir = v
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--ext-order"); ok {
+			extOrder = append(extOrder, splitList(v)...)
+			groupByExt = true
+			continue
+		}
+		if v, ok := flagValue(args, &i, "--dir-priority"); ok {
+			dirPriority = append(dirPriority, splitList(v)...)
+			groupByDir = true
 			continue
 		}
 
@@ -130,21 +778,66 @@ func main() {
 			}
 			if arg == "write" {
 				command = "write"
-				if i+1 < len(args) {
-					writeTarget = args[i+1]
-					i++
-				}
 				continue
 			}
 			if arg == "href" {
 				command = "href"
 				continue
 			}
+			if arg == "hash" {
+				command = "hash"
+				continue
+			}
+			if arg == "list" {
+				command = "list"
+				continue
+			}
+			if arg == "languages" {
+				command = "languages"
+				continue
+			}
+			if arg == "push" || arg == "pop" || arg == "stack" || arg == "registers" || arg == "split" {
+				command = arg
+				continue
+			}
 		}
 
 		filePaths = append(filePaths, arg)
 	}
 
+	// Everything after parsing sees the --chdir directory, so relative path
+	// arguments, flag paths, and repo-root discovery resolve as if run there.
+	if chdir != "" {
+		if err := os.Chdir(chdir); err != nil {
+			fmt.Printf("Error: --chdir: %v\n", err)
+			exit(1)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		verbosef("Working directory: %s\n", wd)
+	}
+	if sandboxDir != "" {
+		if err := setSandboxRoot(sandboxDir); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		verbosef("Sandbox root: %s\n", sandboxRoot)
+	}
+
+	// --profile and --memprofile are for debugging slow pulls and are left out
+	// of the usage text.
+	if err := startProfiles(cpuProfile, memProfile); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	defer stopProfiles()
+
+	if envExpand {
+		for i, p := range filePaths {
+			filePaths[i] = expandPathArg(p)
+		}
+	}
+
 	if sampleMode {
 		if sampleMinSet && !sampleMaxSet {
 			sampleMax = sampleMin
@@ -160,197 +853,1041 @@ func main() {
 		}
 		if sampleMin < 1 || sampleMax < 1 || sampleMax < sampleMin {
 			fmt.Println("Error: Invalid sample range. Ensure --sample-min >= 1 and --sample-max >= --sample-min")
-			os.Exit(1)
+			exit(1)
 		}
 	}
 
-	switch command {
-	case "clear":
-		if err := clipboard.WriteAll(""); err != nil {
-			fmt.Printf("Error clearing clipboard: %v\n", err)
-			os.Exit(1)
+	if groupByDir && groupByExt {
+		fmt.Println("Error: --group-by-dir and --group-by-ext can't be combined")
+		exit(1)
+	}
+	if groupByExt && command != "list" {
+		if err := checkGroupByExt(squashHeaders, format, templatePath); err != nil {
+			fmt.Println(err)
+			exit(1)
 		}
-		fmt.Println("Clipboard cleared.")
+	}
+	if squashHeaders && strip.keepBlank {
+		fmt.Println("Error: --squash-headers can't be combined with --strip-blank=false: kept blank lines would blur the boundary between files")
+		exit(1)
+	}
+	if squashHeaders && command == "href" {
+		fmt.Println("Error: --squash-headers doesn't apply to href: fetched pages keep their blank lines, which would blur the boundary between them")
+		exit(1)
+	}
+	if groupByDir && !isValidDirOrder(dirOrder) {
+		fmt.Printf("Error: Invalid value for --dir-order: %q (expected alpha, count, or readme)\n", dirOrder)
+		exit(1)
+	}
+
+	if linkCheck && command != "href" {
+		fmt.Println("Error: --check only applies to href")
+		exit(1)
+	}
+	if fetch.codeBlocks && command != "href" {
+		fmt.Println("Error: --code-blocks only applies to href")
+		exit(1)
+	}
+	if fetch.jq != nil || jqNonJSON != "" {
+		switch {
+		case command != "href":
+			fmt.Println("Error: --jq only applies to href")
+			exit(1)
+		case fetch.jq == nil:
+			fmt.Println("Error: --jq-non-json needs --jq <filter>")
+			exit(1)
+		case fetch.text || fetch.codeBlocks:
+			fmt.Println("Error: --jq can't be combined with --text, --readability, or --code-blocks")
+			exit(1)
+		}
+		fetch.passNonJSON = jqNonJSON == jqNonJSONPass
+	}
+	if fetch.raw {
+		switch {
+		case command != "href":
+			fmt.Println("Error: --raw only applies to href")
+			exit(1)
+		case fetch.text || fetch.codeBlocks:
+			fmt.Println("Error: --raw can't be combined with --text, --readability, or --code-blocks")
+			exit(1)
+		case format != "" && format != "plain" || templatePath != "":
+			fmt.Println("Error: --raw can't be combined with --format or --template")
+			exit(1)
+		}
+	}
+	if fetchUser != "" {
+		if command != "href" {
+			fmt.Println("Error: --user only applies to href")
+			exit(1)
+		}
+		if err := fetch.setUser(fetchUser); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	}
+
+	if respectEditorConfig {
+		if strip.reindent == nil {
+			fmt.Println("Error: --respect-editorconfig needs --reindent")
+			exit(1)
+		}
+		strip.reindent.editorconfig = newEditorConfigs()
+	}
+
+	if jsonIndent >= 0 && (format != "json" || templatePath != "") {
+		fmt.Println("Error: --json-pretty and --json-indent only apply to --format json (jsonl stays one record per line)")
+		exit(1)
+	}
+
+	tmpl, err := loadOutputTemplate(format, templatePath)
+	if err != nil {
+		fmt.Println(err.Error())
+		exit(1)
+	}
+	if jsonIndent >= 0 {
+		tmpl = nil
+	}
+
+	outOpts := outputOptions{
+		tmpl:         tmpl,
+		jsonl:        format == "jsonl" && templatePath == "",
+		jsonEncoded:  jsonIndent >= 0,
+		jsonIndent:   max(jsonIndent, 0),
+		includeEmpty: includeEmpty,
+		strip:        strip,
+		squash:       squashHeaders,
+		noHeader:     noHeader,
+		separator:    fileSeparator,
+		dedupe:       dedupeContent,
+		raw:          fetch.raw,
+		mergeSmall:   mergeSmall,
+		wrap:         wrapCols,
+		wrapAll:      wrapAll,
+		pathStyle:    pathStyle,
+		resolveLinks: resolveSymlinks,
+
+		prependTree:   prependTree,
+		appendSummary: appendSummary,
+	}
+	if estimateCost {
+		if tokenModel == "" {
+			fmt.Println("Error: --estimate-cost needs --model <model>")
+			exit(1)
+		}
+		price, err := lookupPrice(tokenModel)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		outOpts.price = &price
+	}
+	if countMode || countPerFile || countOnly || appendSummary || estimateCost {
+		outOpts.counter = newTokenCounter(tokenModel)
+		outOpts.countReport = countMode || countOnly
+		outOpts.countFiles = countPerFile
+		outOpts.countOnly = countOnly
+	}
+	if onlyNew != "" || manifestOut != "" {
+		var prev manifest
+		if onlyNew != "" {
+			if prev, err = readManifest(onlyNew); err != nil {
+				fatal(err)
+			}
+		}
+		outOpts.changes = newChangeTracker(prev)
+	}
+
+	if assumeYes {
+		warnSize = 0
+	}
+	writeOpts := writeOptions{appendMode: appendMode, onConflict: onConflict, mode: newFileMode, register: register}
+	dest := destination{discard: countOnly, stdout: toStdout, file: outTarget, register: register, hash: command == "hash", clipType: clipType, retryClipboard: retryClipboard, warnSize: warnSize, normalize: normalize, quotes: normalizeQuotes, asciiMode: asciiMode}
+	if split.maxBytes > 0 || split.maxTokens > 0 {
+		split.counter = newTokenCounter(tokenModel)
+		split.dir, split.onConflict = outTarget, onConflict
+		dest.split = &split
+	} else if split.interactive {
+		fmt.Println("Error: --interactive-split needs --split-by-size or --split-by-tokens")
+		exit(1)
+	}
+	if summaryMode && !dest.hash {
+		opts, err := resolveSummaryOptions(summary)
+		if err != nil {
+			fmt.Println(err.Error())
+			exit(1)
+		}
+		opts.fetch = fetch
+		dest.summary = &opts
+	}
+
+	modes := clipboardModes{
+		appendMode:  appendMode,
+		prependMode: prependMode,
+		strict:      strictMode,
+	}
+
+	if err := setSelection(selection); err != nil {
+		fmt.Println(err.Error())
+		exit(1)
+	}
+
+	if followLines > 0 && followPath == "" {
+		fmt.Println("Error: --lines needs --follow <file>")
+		exit(1)
+	}
+	if followPath != "" {
+		if command != "" || len(filePaths) > 0 || toStdout || outTarget != "" || register != "" {
+			fmt.Println("Error: --follow mirrors one file into the clipboard and takes no other paths, commands, or outputs")
+			exit(1)
+		}
+		if followLines == 0 {
+			followLines = defaultFollowWin
+		}
+		if err := followFile(followPath, followLines); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	switch command {
+	case "clear":
+		if register != "" {
+			if err := clearRegister(register); err != nil {
+				fatal(err)
+			}
+			fmt.Printf("Register %s cleared.\n", register)
+			return
+		}
+		if !assumeYes && isTerminal(os.Stdin) {
+			current, err := readClipboard()
+			if err == nil && current != "" {
+				if !confirm(fmt.Sprintf("Clipboard holds %d bytes. Clear it?", len(current))) {
+					fmt.Println("Aborted.")
+					return
+				}
+			}
+		}
+		if err := writeClipboard(""); err != nil {
+			fmt.Printf("Error clearing clipboard: %v\n", err)
+			exit(1)
+		}
+		fmt.Println("Clipboard cleared.")
+		return
+
+	case "emit":
+		if outTarget != "" {
+			writeClipboardToFile(outTarget, writeOpts)
+			return
+		}
+		content, err := readSource(register)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Print(content)
+		return
+
+	case "split":
+		if outTarget == "" {
+			fmt.Println("Error: Missing output directory. Usage: pull split --out <dir>")
+			exit(1)
+		}
+		content, err := readSource(register)
+		if err != nil {
+			fatal(err)
+		}
+		if err := unpackFiles(content, outTarget, writeOpts); err != nil {
+			fatal(err)
+		}
+		return
+
+	case "registers":
+		if err := listRegisters(os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+
+	case "languages":
+		printLanguages(os.Stdout)
+		return
+
+	case "push":
+		if err := pushClipboard(); err != nil {
+			fatal(err)
+		}
+		return
+
+	case "pop":
+		if err := popClipboard(); err != nil {
+			fatal(err)
+		}
+		return
+
+	case "stack":
+		if len(filePaths) > 0 && filePaths[0] != "list" {
+			fmt.Printf("Error: Unknown stack command %q. Usage: pull stack list\n", filePaths[0])
+			exit(1)
+		}
+		if err := listStack(os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+
+	case "write":
+		if len(filePaths) > 0 {
+			writeTarget = filePaths[0]
+		}
+		if writeTarget == "" {
+			fmt.Println("Error: Missing file path. Usage: pull write ./some_file")
+			exit(1)
+		}
+		writeClipboardToFile(writeTarget, writeOpts)
+		return
+
+	case "href":
+		if len(filePaths) == 0 {
+			fmt.Println("Error: Missing URL(s). Usage: pull href <url> [url2 ...]")
+			exit(1)
+		}
+		if linkCheck {
+			if !checkLinks(filePaths, fetch) {
+				exit(1)
+			}
+			return
+		}
+		deliver(dest, modes, func(w io.Writer, existing string) error {
+			out := newEmitter(w, outOpts)
+			if dedupeAppend && appendMode {
+				out.skipHeadersIn(existing)
+			}
+			for _, raw := range filePaths {
+				if existsFile(raw) {
+					if err := readLocalIntoBuilder(raw, out); err != nil {
+						return err
+					}
+					continue
+				}
+				u := normalizeURL(raw)
+				if id := gistID(u); id != "" {
+					if err := fetchGistIntoBuilder(id, out); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := fetchIntoBuilder(u, out, fetch); err != nil {
+					return err
+				}
+			}
+			if err := out.finish(); err != nil {
+				return err
+			}
+			return out.checkEmpty(failOnEmpty)
+		})
+		runHook("--post-write", postWrite)
+		return
+	}
+
+	// Default mode: pull local files/dirs AND/OR GitHub paths. The hash command
+	// runs the same pipeline into a hash sink.
+	if command == "hash" && len(filePaths) == 0 && !fromClipboard {
+		fmt.Println("Error: Missing path(s). Usage: pull hash <file/dir> ...")
+		exit(1)
+	}
+	if command == "list" && len(filePaths) == 0 && !fromClipboard {
+		fmt.Println("Error: Missing path(s). Usage: pull list <file/dir> ...")
+		exit(1)
+	}
+	if (list.null || list.sizes) && command != "list" {
+		fmt.Println("Error: --null and --sizes only apply to the list command")
+		exit(1)
+	}
+	if fromClipboard {
+		current, err := readClipboard()
+		if err != nil {
+			fmt.Printf("Error reading clipboard: %v\n", err)
+			exit(1)
+		}
+		filePaths = append(filePaths, pathsFromClipboard(current)...)
+		if len(filePaths) == 0 {
+			fmt.Println("Error: --from-clipboard found no paths in the clipboard")
+			exit(1)
+		}
+	}
+	for _, p := range filePaths {
+		if looksLikeGitHubSpec(p) {
+			continue
+		}
+		if err := checkSandbox(p); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	}
+
+	runHook("--pre-walk", preWalk)
+
+	filter := &localFilter{
+		includeIgnored:     includeIgnored,
+		includeHidden:      includeHidden,
+		includeVCS:         includeVCS,
+		ignoreSymlinks:     ignoreSymlinks,
+		includeBinary:      includeBinary,
+		respectBinaryAttrs: respectBinaryAttrs,
+		globalExcludes:     respectExcludesFile,
+		tests:              tests,
+		order:              filterOrder,
+	}
+	if len(excludes) > 0 {
+		filter.excludes = gitignore.CompileIgnoreLines(excludes...)
+	}
+	var includes []string
+	if len(includeFiles) > 0 {
+		for _, p := range includeFiles {
+			if err := checkSandbox(p); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			lines, err := readPatternFile(p)
+			if err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			includes = append(includes, lines...)
+		}
+		filter.includes = gitignore.CompileIgnoreLines(includes...)
+	}
+	filter.setExts(exts)
+	if inferExt && len(exts) == 0 {
+		if ext := inferExtension(filePaths, filter); ext != "" {
+			filter.setExts([]string{ext})
+			infof("Inferred extension: %s\n", ext)
+		}
+	}
+	var cache *walkCache
+	cacheFingerprint := ""
+	if useCache && !noCache {
+		cache = openWalkCache()
+		cacheFingerprint = walkFingerprint(filter, excludes, includes)
+	}
+
+	// localFiles walks startPath and picks and orders its files: everything
+	// a pull does before reading content, which is all list does.
+	localFiles := func(startPath string, filter *localFilter) ([]string, error) {
+		var files []string
+		var err error
+		if gitSelect != "" {
+			if files, err = gitFiles(startPath, filter, gitSelect); err != nil {
+				return nil, err
+			}
+		} else if cache != nil {
+			files, err = cache.collect(startPath, filter, cacheFingerprint, refreshCache)
+		} else {
+			files, err = collectLocalFiles(startPath, filter)
+		}
+		if err != nil {
+			warnPath("Error walking", startPath, err)
+		}
+		if skipOutliers > 0 {
+			files = dropOutliers(files, skipOutliers)
+		}
+		if groupByDir {
+			files = groupFilesByDir(startPath, files, dirOrder, dirPriority)
+		}
+		return files, nil
+	}
+
+	if command == "list" {
+		list.style = pathStyle
+		lw := bufio.NewWriter(os.Stdout)
+		for _, startPath := range filePaths {
+			if looksLikeGitHubSpec(startPath) {
+				fmt.Printf("Error: list only takes local paths, not %s\n", startPath)
+				exit(1)
+			}
+			files, err := localFiles(startPath, filter.forStart(startPath))
+			if err != nil {
+				fatal(err)
+			}
+			if groupByExt {
+				var ordered []string
+				for _, g := range groupFilesByExt(files, extOrder) {
+					ordered = append(ordered, g.files...)
+				}
+				files = ordered
+			}
+			for _, p := range files {
+				writeListEntry(lw, p, list)
+			}
+		}
+		if err := lw.Flush(); err != nil {
+			fatal(err)
+		}
+		if cache != nil {
+			cache.save()
+		}
+		return
+	}
+
+	deliver(dest, modes, func(w io.Writer, existing string) error {
+		out := newEmitter(w, outOpts)
+		if dedupeAppend && appendMode {
+			out.skipHeadersIn(existing)
+		}
+		for _, startPath := range filePaths {
+			// GitHub mode
+			if looksLikeGitHubSpec(startPath) {
+				spec, err := parseGitHubSpec(startPath)
+				if err != nil {
+					return err
+				}
+				if err := fetchGitHubSpecIntoBuilder(spec, out); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Local filesystem mode
+			filter := filter.forStart(startPath)
+			if sampleMode {
+				if err := sampleLocal(startPath, out, filter, sampleMin, sampleMax); err != nil {
+					warnPath("Error sampling", startPath, err)
+				}
+			} else {
+				files, err := localFiles(startPath, filter)
+				if err != nil {
+					return err
+				}
+				if groupByExt {
+					for _, g := range groupFilesByExt(files, extOrder) {
+						loaded := loadFiles(g.files, out.strip, workers)
+						if out.includeEmpty || anyContent(loaded) {
+							out.note(extGroupHeader(g.ext))
+						}
+						for _, lf := range loaded {
+							emitLoaded(out, lf)
+						}
+					}
+					continue
+				}
+				for _, lf := range loadFiles(files, out.strip, workers) {
+					emitLoaded(out, lf)
+				}
+			}
+		}
+		if err := out.finish(); err != nil {
+			return err
+		}
+		return out.checkEmpty(failOnEmpty)
+	})
+	if cache != nil {
+		cache.save()
+	}
+
+	if manifestOut != "" {
+		if err := outOpts.changes.next.write(manifestOut); err != nil {
+			fatal(err)
+		}
+	}
+	runHook("--post-write", postWrite)
+}
+
+// deliver opens the sink for dest, lets writeNewContent fill it, and closes it.
+// writeNewContent also receives the content being appended to or prepended to,
+// if any.
+func deliver(dest destination, modes clipboardModes, writeNewContent func(w io.Writer, existing string) error) {
+	out, existing, err := openSink(dest, modes)
+	if err != nil {
+		fatal(err)
+	}
+	if err := writeNewContent(out, existing); err != nil {
+		fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		fatal(err)
+	}
+	if msg := out.doneMessage(); msg != "" {
+		fmt.Println(msg)
+	}
+}
+
+// pathsFromClipboard extracts the paths to re-pull from clipboard content. If
+// the content has file: headers (a previous pull), only the headers count;
+// otherwise every non-blank line is taken as a path. Local paths that no longer
+// exist are reported and dropped.
+func pathsFromClipboard(content string) []string {
+	lines := strings.Split(content, "\n")
+	var candidates []string
+	for _, line := range lines {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "// ")
+		if strings.HasPrefix(line, "file: ") {
+			p, _ := splitDedupedPath(strings.TrimPrefix(line, "file: "))
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				candidates = append(candidates, line)
+			}
+		}
+	}
+
+	var out []string
+	for _, p := range candidates {
+		if !looksLikeGitHubSpec(p) && !existsFile(p) {
+			warnPath("Skipping", p, "not a file")
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// writeOptions control how write and emit --out save the clipboard.
+type writeOptions struct {
+	appendMode bool
+	onConflict string
+	mode       os.FileMode // permissions for a new file (--mode)
+	register   string      // read this register instead of the clipboard (--register)
+}
+
+// writeClipboardToFile saves the clipboard to target, creating parent
+// directories as needed. With appendMode the content is added to the end of an
+// existing file instead of replacing it. Either way the file is replaced
+// atomically and an existing file keeps its permissions.
+func writeClipboardToFile(target string, opts writeOptions) {
+	content, err := readSource(opts.register)
+	if err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	appendMode := opts.appendMode
+	if !appendMode {
+		resolved, ok := resolveConflict(target, opts.onConflict)
+		if !ok {
+			fmt.Printf("Skipped: %s already exists\n", target)
+			exit(exitConflictSkipped)
+		}
+		target = resolved
+	}
+	if err := checkSandbox(target); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	if dir := filepath.Dir(target); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Printf("Error creating directory: %v\n", err)
+			exit(1)
+		}
+	}
+	mode := opts.mode
+	if st, err := os.Stat(target); err == nil {
+		mode = st.Mode().Perm()
+		if appendMode {
+			existing, err := os.ReadFile(target)
+			if err != nil {
+				fmt.Printf("Error reading file: %v\n", err)
+				exit(1)
+			}
+			content = string(existing) + content
+		}
+	}
+	if err := writeFileAtomic(target, []byte(content), mode); err != nil {
+		fmt.Printf("Error writing file: %v\n", err)
+		exit(1)
+	}
+	if appendMode {
+		fmt.Printf("Clipboard content appended to %s\n", target)
+		return
+	}
+	fmt.Printf("Clipboard content written to %s\n", target)
+}
+
+// writeFileAtomic writes data to a temporary file next to target and renames
+// it into place, so readers see either the old file or the complete new one,
+// never a truncated mix. The temp file gets mode before the rename.
+func writeFileAtomic(target string, data []byte, mode os.FileMode) error {
+	// Renaming over a symlink would replace the link itself; write through it.
+	if real, err := filepath.EvalSymlinks(target); err == nil {
+		target = real
+	}
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, target)
+}
+
+// --on-conflict policies for writing over an existing file.
+const (
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+	conflictRename    = "rename"
+	conflictPrompt    = "prompt"
+)
+
+// exitConflictSkipped is the exit status when --on-conflict declined to write,
+// so scripts can tell it apart from a failure (1).
+const exitConflictSkipped = 3
+
+func isValidConflictPolicy(v string) bool {
+	switch v {
+	case conflictOverwrite, conflictSkip, conflictRename, conflictPrompt:
+		return true
+	}
+	return false
+}
+
+// resolveConflict applies the --on-conflict policy to target. It returns the
+// path to write, or ok=false when the write should be skipped. prompt asks on
+// a terminal and skips otherwise.
+func resolveConflict(target string, policy string) (string, bool) {
+	if _, err := os.Stat(target); err != nil {
+		return target, true
+	}
+	switch policy {
+	case conflictSkip:
+		return "", false
+	case conflictRename:
+		return nextFreeName(target), true
+	case conflictPrompt:
+		if !isTerminal(os.Stdin) || !confirm(fmt.Sprintf("%s already exists. Overwrite?", target)) {
+			return "", false
+		}
+	}
+	return target, true
+}
+
+// nextFreeName returns target with the smallest -N suffix (before the
+// extension) that doesn't exist yet: notes.txt -> notes-1.txt.
+func nextFreeName(target string) string {
+	ext := filepath.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, n, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// isTerminal reports whether f is attached to an interactive terminal.
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question on stdout and reads the answer from stdin.
+// Anything other than y/yes counts as no.
+func confirm(question string) bool {
+	return confirmOn(os.Stdout, question)
+}
+
+// confirmOn is confirm with the question written to w.
+func confirmOn(w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func errUnknownSelection(name string) error {
+	return fmt.Errorf("Error: Invalid value for --selection: %q (expected clipboard or primary)", name)
+}
+
+// clipboardModes controls how new content is merged with what is already at
+// the destination.
+type clipboardModes struct {
+	appendMode  bool
+	prependMode bool
+	strict      bool // abort instead of warning when the clipboard can't be read
+}
+
+// readExisting reads the current clipboard for append/prepend. A failed read
+// would otherwise silently drop the content the user meant to keep, so it is
+// reported, and is fatal in strict mode.
+func (m clipboardModes) readExisting(flag string) (string, error) {
+	current, err := readClipboard()
+	if err == nil {
+		return current, nil
+	}
+	if m.strict {
+		return "", fmt.Errorf("Error: %s could not read the clipboard: %v", flag, err)
+	}
+	warnf("Warning: %s could not read the clipboard; continuing with new content only: %v\n", flag, err)
+	return "", nil
+}
+
+// expandPathArg expands $VAR and ${VAR} and a leading ~ or ~/ in a path
+// argument (--env-expand). Unset variables expand to "", as in a shell.
+func expandPathArg(p string) string {
+	expanded := os.ExpandEnv(p)
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			expanded = home + expanded[1:]
+		}
+	}
+	if expanded != p {
+		verbosef("Expanded %s -> %s\n", p, expanded)
+	}
+	return expanded
+}
+
+// fetchIntoBuilder fetches u into out, followed by its next pages when
+// --follow-next is set.
+func fetchIntoBuilder(u string, out *emitter, fetch fetchOptions) error {
+	if strings.HasPrefix(u, "file://") {
+		pu, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("href: invalid url %q: %w", u, err)
+		}
+		p := pu.Path
+		if pu.Host != "" && pu.Host != "localhost" {
+			// file://relative/path: treat the "host" as the first path segment.
+			p = pu.Host + p
+		}
+		return readLocalIntoBuilder(p, out)
+	}
+
+	start := u
+	seen := make(map[string]bool)
+	for page := 1; u != ""; page++ {
+		seen[u] = true
+		next, err := fetchPage(u, out, fetch)
+		if err != nil {
+			return err
+		}
+		if !fetch.followNext || next == "" || seen[next] {
+			break
+		}
+		if page >= fetch.maxPages {
+			warnf("Warning: stopping after %d page(s) of %s (--max-pages)\n", page, start)
+			break
+		}
+		u = next
+	}
+	return nil
+}
+
+// fetchPage fetches one URL into out and returns the URL of the next page
+// (see nextPage), or "".
+func fetchPage(u string, out *emitter, fetch fetchOptions) (string, error) {
+	resp, err := fetch.do(http.MethodGet, u)
+	if err != nil {
+		return "", fmt.Errorf("href: request failed for %q: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("href: bad status for %q: %s", u, resp.Status)
+	}
+
+	body, err := readUpTo(resp.Body, maxFetchBytes)
+	if err != nil {
+		return "", fmt.Errorf("href: reading body for %q failed: %w", u, err)
+	}
+
+	isHTML := looksLikeHTML(resp.Header.Get("Content-Type"), body)
+	switch {
+	case fetch.jq != nil:
+		filtered, err := fetch.jq.run(body)
+		switch {
+		case err == nil:
+			emitPage(u, filtered, false, out, fetch)
+		case errors.Is(err, errNotJSON) && fetch.passNonJSON:
+			verbosef("%s is not JSON; copying it without --jq\n", u)
+			emitPage(u, body, isHTML, out, fetch)
+		case errors.Is(err, errNotJSON):
+			return "", fmt.Errorf("href: --jq: %s is not JSON (--jq-non-json pass copies it as is)", u)
+		default:
+			return "", fmt.Errorf("href: --jq %s on %s: %w", fetch.jq.src, u, err)
+		}
+	case fetch.codeBlocks:
+		emitCodeBlocks(u, body, isHTML, out)
+	default:
+		emitPage(u, body, isHTML, out, fetch)
+	}
+	if !fetch.followNext {
+		return "", nil
+	}
+	return nextPage(resp, body, isHTML), nil
+}
+
+// emitPage writes a fetched page as one href: section.
+func emitPage(u string, body []byte, isHTML bool, out *emitter, fetch fetchOptions) {
+	content := string(body)
+	switch {
+	case fetch.raw:
+		// Exactly as served.
+	case fetch.text && isHTML:
+		content = htmlToText(content, fetch.readability)
+	case len(body) > 0 && body[len(body)-1] != '\n':
+		content += "\n"
+	}
+	out.file(fileRecord{
+		Path:    u,
+		RelPath: u,
+		Content: content,
+		Ext:     normalizeExt(path.Ext(strings.SplitN(u, "?", 2)[0])),
+		header:  "href",
+	})
+}
+
+// emitCodeBlocks writes each code sample of a fetched page as its own
+// "href: <url> [block N]" section (--code-blocks).
+func emitCodeBlocks(u string, body []byte, isHTML bool, out *emitter) {
+	blocks := extractCodeBlocks(string(body), isHTML)
+	if len(blocks) == 0 {
+		warnf("Warning: no code blocks in %s\n", u)
 		return
+	}
+	for i, b := range blocks {
+		name := fmt.Sprintf("%s [block %d]", u, i+1)
+		out.file(fileRecord{
+			Path:    name,
+			RelPath: name,
+			Content: b.content,
+			Lang:    b.lang,
+			header:  "href",
+			code:    true,
+		})
+	}
+}
 
-	case "emit":
-		content, err := clipboard.ReadAll()
+// collectLocalFiles walks startPath and returns every file that survives the
+// filter, in walk order. Walk errors on individual entries are reported and
+// skipped rather than aborting the whole walk.
+func collectLocalFiles(startPath string, f *localFilter) ([]string, error) {
+	var files []string
+	// nested holds the filters for repositories found inside the walk, innermost
+	// last. WalkDir is depth-first, so leaving a repo's subtree pops it.
+	var nested []*localFilter
+	err := filepath.WalkDir(startPath, func(p string, d os.DirEntry, err error) error {
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading clipboard: %v\n", err)
-			os.Exit(1)
+			warnPath("Skipping", p, err)
+			return nil
 		}
-		fmt.Print(content)
-		return
-
-	case "write":
-		if writeTarget == "" {
-			fmt.Println("Error: Missing file path. Usage: pull write ./some_file")
-			os.Exit(1)
+		for len(nested) > 0 && !isWithin(nested[len(nested)-1].repoRoot, p) {
+			nested = nested[:len(nested)-1]
 		}
-		content, err := clipboard.ReadAll()
-		if err != nil {
-			fmt.Printf("Error reading clipboard: %v\n", err)
-			os.Exit(1)
+		f := f
+		if len(nested) > 0 {
+			f = nested[len(nested)-1]
 		}
-		if err := os.WriteFile(writeTarget, []byte(content), 0644); err != nil {
-			fmt.Printf("Error writing file: %v\n", err)
-			os.Exit(1)
+		isStart := p == startPath
+		if f.skipSymlink(d, isStart) {
+			return nil
 		}
-		fmt.Printf("Clipboard content written to %s\n", writeTarget)
-		return
-
-	case "href":
-		if len(filePaths) == 0 {
-			fmt.Println("Error: Missing URL(s). Usage: pull href <url> [url2 ...]")
-			os.Exit(1)
+		if d.IsDir() && f.skipDir(d.Name(), isStart) {
+			return filepath.SkipDir
 		}
-		final, err := buildWithClipboardModes(appendMode, prependMode, func(sb *strings.Builder) error {
-			for _, raw := range filePaths {
-				u := normalizeURL(raw)
-				if err := fetchIntoBuilder(u, sb); err != nil {
-					return err
-				}
+		if f.hidden(d.Name(), isStart) {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
 			return nil
-		})
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
-		}
-		if err := clipboard.WriteAll(final); err != nil {
-			fmt.Printf("Error writing to clipboard: %v\n", err)
-			os.Exit(1)
 		}
-		fmt.Println("Copied to clipboard!")
-		return
-	}
-
-	// Default mode: pull local files/dirs AND/OR GitHub paths.
-	repoRoot, ign := loadGitIgnoreForCWD()
-	_ = repoRoot
-
-	final, err := buildWithClipboardModes(appendMode, prependMode, func(sb *strings.Builder) error {
-		for _, startPath := range filePaths {
-			// GitHub mode
-			if looksLikeGitHubSpec(startPath) {
-				spec, err := parseGitHubSpec(startPath)
-				if err != nil {
-					return err
-				}
-				if err := fetchGitHubSpecIntoBuilder(spec, sb); err != nil {
-					return err
-				}
-				continue
+		if d.IsDir() {
+			if f.pruneDir(p) {
+				return filepath.SkipDir
 			}
-
-			// Local filesystem mode
-			if sampleMode {
-				if err := sampleLocal(startPath, sb, repoRoot, ign, includeIgnored, sampleMin, sampleMax); err != nil {
-					fmt.Printf("Error sampling %s: %v\n", startPath, err)
-				}
-			} else {
-				err := filepath.WalkDir(startPath, func(p string, d os.DirEntry, err error) error {
-					if err != nil {
-						fmt.Printf("Skipping %s: %v\n", p, err)
-						return nil
-					}
-					if !includeIgnored && isIgnored(repoRoot, ign, p) {
-						if d.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil
-					}
-					if d.IsDir() {
-						return nil
-					}
-					processFile(p, sb)
-					return nil
-				})
-				if err != nil {
-					fmt.Printf("Error walking %s: %v\n", startPath, err)
-				}
+			if f.walked != nil {
+				f.walked.dir(p)
+			}
+			if !isStart && isRepoDir(p) {
+				nested = append(nested, f.forRoot(p))
 			}
+			return nil
+		}
+		if isStart && f.walked != nil {
+			f.walked.file(p)
+		}
+		if !f.allowFile(p) {
+			return nil
 		}
+		files = append(files, p)
 		return nil
 	})
-
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
-	}
-
-	if err := clipboard.WriteAll(final); err != nil {
-		fmt.Printf("Error writing to clipboard: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Println("Copied to clipboard!")
+	return files, err
 }
 
-func buildWithClipboardModes(appendMode, prependMode bool, writeNewContent func(sb *strings.Builder) error) (string, error) {
-	var sb strings.Builder
+// isRepoDir reports whether dir is the top of a git repository or worktree
+// (.git may be a directory or, for submodules and worktrees, a file).
+func isRepoDir(dir string) bool {
+	_, ok := gitDir(dir)
+	return ok
+}
 
-	if appendMode {
-		current, err := clipboard.ReadAll()
-		if err == nil {
-			sb.WriteString(current)
-			if current != "" && !strings.HasSuffix(current, "\n") {
-				sb.WriteString("\n")
-			}
-		}
+// gitDir returns the git directory of the repository rooted at dir. For a
+// worktree or submodule, .git is a "gitdir: <path>" file and the path it
+// names (relative to dir if not absolute) is returned instead.
+func gitDir(dir string) (string, bool) {
+	p := filepath.Join(dir, ".git")
+	st, err := os.Stat(p)
+	if err != nil {
+		return "", false
 	}
-
-	var previousContent string
-	if prependMode {
-		c, err := clipboard.ReadAll()
-		if err == nil {
-			previousContent = c
-		}
+	if st.IsDir() {
+		return p, true
 	}
-
-	if err := writeNewContent(&sb); err != nil {
-		return "", err
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", false
 	}
-
-	finalContent := sb.String()
-	if prependMode && previousContent != "" {
-		if finalContent != "" && !strings.HasSuffix(finalContent, "\n") {
-			finalContent += "\n"
-		}
-		finalContent += previousContent
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	if !ok {
+		return "", false
 	}
-
-	return finalContent, nil
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return target, true
 }
 
-func fetchIntoBuilder(u string, sb *strings.Builder) error {
-	client := &http.Client{Timeout: 15 * time.Second}
+// isWithin reports whether p is dir or lies below it. Both are walk paths,
+// so they share the same form.
+func isWithin(dir string, p string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
 
-	req, err := http.NewRequest("GET", u, nil)
-	if err != nil {
-		return fmt.Errorf("href: invalid url %q: %w", u, err)
+// readLocalIntoBuilder is the href path for local files: the content is copied
+// as-is (no comment stripping) under a file: header.
+func readLocalIntoBuilder(p string, out *emitter) error {
+	if err := checkSandbox(p); err != nil {
+		return err
 	}
-	req.Header.Set("User-Agent", githubUserAgent)
-
-	resp, err := client.Do(req)
+	f, err := os.Open(p)
 	if err != nil {
-		return fmt.Errorf("href: request failed for %q: %w", u, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("href: bad status for %q: %s", u, resp.Status)
+		return fmt.Errorf("href: %w", err)
 	}
+	defer f.Close()
 
-	body, err := readUpTo(resp.Body, maxFetchBytes)
+	body, err := readUpTo(f, maxFetchBytes)
 	if err != nil {
-		return fmt.Errorf("href: reading body for %q failed: %w", u, err)
+		return fmt.Errorf("href: reading %q failed: %w", p, err)
 	}
-
-	sb.WriteString(fmt.Sprintf("href: %s\n", u))
-	sb.WriteString(string(body))
+	content := string(body)
 	if len(body) > 0 && body[len(body)-1] != '\n' {
-		sb.WriteString("\n")
+		content += "\n"
 	}
+	out.file(localRecord(p, content))
 	return nil
 }
 
@@ -366,45 +1903,183 @@ func readUpTo(r io.Reader, max int64) ([]byte, error) {
 	return b, nil
 }
 
+// normalizeURL prepends https:// unless s already names a scheme. A bare
+// "host:port" like localhost:3000 parses with "localhost" as its scheme, so a
+// scheme only counts when it is followed by "//". Unbracketed IPv6 hosts
+// (::1, 2001:db8::1/x) are bracketed so their colons aren't read as a port.
 func normalizeURL(s string) string {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return s
 	}
-	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
-		return s
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+		if strings.HasPrefix(s[len(u.Scheme)+1:], "//") {
+			return s
+		}
 	}
-	return "https://" + s
-}
 
-func processFile(p string, sb *strings.Builder) {
-	absPath, err := filepath.Abs(p)
-	if err != nil {
-		absPath = p
+	host, rest := s, ""
+	if i := strings.IndexAny(s, "/?#"); i != -1 {
+		host, rest = s[:i], s[i:]
+	}
+	if ip := net.ParseIP(host); ip != nil && strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	candidate := "https://" + host + rest
+	if u, err := url.Parse(candidate); err == nil && u.Host != "" {
+		return u.String()
 	}
+	return candidate
+}
+
+func processFile(p string, out *emitter) {
+	emitLoaded(out, loadFile(p, out.strip))
+}
 
-	sb.WriteString(fmt.Sprintf("file: %s\n", absPath))
+// loadedFile is a local file read and stripped, ready to be emitted.
+type loadedFile struct {
+	path     string
+	content  string
+	sum      string // hex digest (--hash-algo) of the raw file, for --only-new/--manifest-out
+	lines    int    // raw line count; set when over --max-line-count
+	redacted int    // string literals blanked by --redact-strings
+	marked   int    // --grep-mark runs bracketed
+	noMatch  bool   // --grep-mark found nothing: leave the file out
+	err      error
+}
 
+func loadFile(p string, opts stripOptions) loadedFile {
+	if checkSandbox(p) != nil {
+		return loadedFile{path: p, err: errOutsideSandbox}
+	}
 	file, err := os.Open(p)
 	if err != nil {
-		fmt.Printf("Could not open %s: %v\n", p, err)
-		return
+		return loadedFile{path: p, err: err}
 	}
 	defer file.Close()
+	h := newContentHash()
+	var lc lineCounter
+	content := stripContent(io.TeeReader(file, io.MultiWriter(h, &lc)), p, opts)
+	if opts.maxLines > 0 && lc.count() > opts.maxLines {
+		return loadedFile{path: p, lines: lc.count()}
+	}
+	if lc.mixedEndings() {
+		verbosef("Mixed line endings in %s: %d CRLF and %d LF (output uses LF)\n", p, lc.crlf, lc.lines-lc.crlf)
+	}
+	if opts.reindent != nil {
+		content = opts.reindent.reindent(p, content)
+	}
+	if opts.dedent {
+		content = dedent(content)
+	}
+	redacted := 0
+	if opts.redactStrings {
+		first, _, _ := strings.Cut(content, "\n")
+		content, redacted = redactStrings(content, detectLanguage(p, first))
+	}
+	// Marking comes last so the brackets land around the lines as emitted.
+	marked := 0
+	if len(opts.markers) > 0 {
+		if content, marked = markMatches(content, opts.markers); marked == 0 {
+			return loadedFile{path: p, noMatch: true}
+		}
+	}
+	return loadedFile{path: p, content: content, sum: hex.EncodeToString(h.Sum(nil)), redacted: redacted, marked: marked}
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmed := strings.TrimSpace(line)
-		if len(trimmed) == 0 {
-			continue
+func emitLoaded(out *emitter, lf loadedFile) {
+	out.matched++
+	if lf.err != nil {
+		warnPath("Could not open", lf.path, lf.err)
+		if out.includeEmpty {
+			out.file(localRecord(lf.path, ""))
 		}
-		if strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") {
-			continue
+		return
+	}
+	if lf.lines > 0 {
+		verbosef("Skipping %s: %d lines (over --max-line-count %d)\n", lf.path, lf.lines, out.strip.maxLines)
+		return
+	}
+	if lf.noMatch {
+		verbosef("Skipping %s: no line matches --grep-mark\n", lf.path)
+		return
+	}
+	if out.changes != nil && !out.changes.observe(lf.path, lf.sum) {
+		return
+	}
+	out.redacted += lf.redacted
+	out.marked += lf.marked
+	// The content is buffered before the header is written so a file that is
+	// all comments and blank lines doesn't leave a lonely header behind.
+	if lf.content == "" && !out.includeEmpty {
+		return
+	}
+	out.file(localRecord(lf.path, lf.content))
+}
+
+// minParallelFiles is the smallest pull worth fanning out to workers; below it
+// goroutine setup costs more than it saves.
+const minParallelFiles = 64
+
+// loadFiles reads and strips paths with up to workers goroutines. Results are
+// returned in input order so output stays deterministic.
+func loadFiles(paths []string, opts stripOptions, workers int) []loadedFile {
+	results := make([]loadedFile, len(paths))
+	if workers <= 1 || len(paths) < minParallelFiles {
+		for i, p := range paths {
+			results[i] = loadFile(p, opts)
 		}
-		sb.WriteString(line)
-		sb.WriteString("\n")
+		return results
 	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = loadFile(paths[i], opts)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// readPatternFile reads gitignore-style patterns, one per line. Blank lines and
+// # comments are dropped by the matcher itself.
+func readPatternFile(p string) ([]string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("Error: reading patterns: %v", err)
+	}
+	return strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n"), nil
+}
+
+// parseSize parses a byte count with an optional k/m/g suffix (powers of 1024),
+// e.g. "512", "100k", "2M".
+func parseSize(raw string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(s, "b")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1<<10, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1<<20, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "g"):
+		mult, s = 1<<30, strings.TrimSuffix(s, "g")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
 }
 
 func parseSampleValue(raw string, flagName string) (int, error) {
@@ -415,41 +2090,79 @@ func parseSampleValue(raw string, flagName string) (int, error) {
 	return v, nil
 }
 
+// boolFlag matches a boolean flag given as "--name" (true) or "--name=<bool>".
+// Unlike flagValue it never consumes the next argument.
+func boolFlag(arg string, name string) (bool, bool) {
+	if arg == name {
+		return true, true
+	}
+	if !strings.HasPrefix(arg, name+"=") {
+		return false, false
+	}
+	v, err := strconv.ParseBool(strings.TrimPrefix(arg, name+"="))
+	if err != nil {
+		fmt.Printf("Error: Invalid value for %s: %q (expected true or false)\n", name, strings.TrimPrefix(arg, name+"="))
+		exit(1)
+	}
+	return v, true
+}
+
+// flagValue matches a flag that takes a value, accepting both "--name value" and
+// "--name=value". When the separate form is used, i is advanced past the value.
+func flagValue(args []string, i *int, name string) (string, bool) {
+	arg := args[*i]
+	if strings.HasPrefix(arg, name+"=") {
+		return strings.TrimPrefix(arg, name+"="), true
+	}
+	if arg != name {
+		return "", false
+	}
+	if *i+1 >= len(args) {
+		fmt.Printf("Error: Missing value for %s\n", name)
+		exit(1)
+	}
+	*i++
+	return args[*i], true
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(raw string) []string {
+	var out []string
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 type fileEntry struct {
 	path string
 	abs  string
 }
 
-func sampleLocal(startPath string, sb *strings.Builder, repoRoot string, ign *gitignore.GitIgnore, includeIgnored bool, min, max int) error {
+func sampleLocal(startPath string, out *emitter, f *localFilter, min, max int) error {
 	info, err := os.Stat(startPath)
 	if err != nil {
 		return err
 	}
 	if !info.IsDir() {
-		if !includeIgnored && isIgnored(repoRoot, ign, startPath) {
+		if !f.allowFile(startPath) {
 			return nil
 		}
-		processFile(startPath, sb)
+		processFile(startPath, out)
 		return nil
 	}
 
+	files, err := collectLocalFiles(startPath, f)
+	if err != nil {
+		return err
+	}
+
 	filesByDir := make(map[string][]fileEntry)
 	var allFiles []string
-
-	err = filepath.WalkDir(startPath, func(p string, d os.DirEntry, err error) error {
-		if err != nil {
-			fmt.Printf("Skipping %s: %v\n", p, err)
-			return nil
-		}
-		if !includeIgnored && isIgnored(repoRoot, ign, p) {
-			if d.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if d.IsDir() {
-			return nil
-		}
+	for _, p := range files {
 		absPath, err := filepath.Abs(p)
 		if err != nil {
 			absPath = p
@@ -457,15 +2170,11 @@ func sampleLocal(startPath string, sb *strings.Builder, repoRoot string, ign *gi
 		allFiles = append(allFiles, absPath)
 		dir := filepath.Dir(absPath)
 		filesByDir[dir] = append(filesByDir[dir], fileEntry{path: p, abs: absPath})
-		return nil
-	})
-	if err != nil {
-		return err
 	}
 
 	if len(allFiles) > 0 {
 		sort.Strings(allFiles)
-		writeFileTree(startPath, allFiles, sb)
+		writeFileTree(startPath, allFiles, out)
 	}
 
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -482,23 +2191,25 @@ func sampleLocal(startPath string, sb *strings.Builder, repoRoot string, ign *gi
 		}
 		selected := sampleEntries(entries, min, max, rng)
 		for _, entry := range selected {
-			processFile(entry.path, sb)
+			processFile(entry.path, out)
 		}
 	}
 
 	return nil
 }
 
-func writeFileTree(root string, filePaths []string, sb *strings.Builder) {
+func writeFileTree(root string, filePaths []string, out *emitter) {
 	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		absRoot = root
 	}
+	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("filetree: %s\n", absRoot))
 	for _, p := range filePaths {
 		sb.WriteString(p)
 		sb.WriteString("\n")
 	}
+	out.note(sb.String())
 }
 
 func sampleEntries(entries []fileEntry, min, max int, rng *rand.Rand) []fileEntry {
@@ -521,6 +2232,159 @@ func sampleEntries(entries []fileEntry, min, max int, rng *rand.Rand) []fileEntr
 	return out[:target]
 }
 
+func isValidDirOrder(order string) bool {
+	switch order {
+	case "alpha", "count", "readme":
+		return true
+	}
+	return false
+}
+
+// groupFilesByDir clusters files by their parent directory while keeping the
+// walk order inside each group. Groups listed in priority come first (in the
+// order given); the remaining groups are ordered by the dir order mode:
+//
+//	alpha   directory path, lexically
+//	count   most files first
+//	readme  directories containing a README first, then alphabetically
+func groupFilesByDir(startPath string, files []string, order string, priority []string) []string {
+	byDir := make(map[string][]string)
+	var dirs []string
+	for _, p := range files {
+		dir := filepath.Dir(p)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], p)
+	}
+
+	rank := func(dir string) int {
+		rel, err := filepath.Rel(startPath, dir)
+		if err != nil {
+			rel = dir
+		}
+		rel = filepath.ToSlash(rel)
+		clean := filepath.ToSlash(filepath.Clean(dir))
+		for i, want := range priority {
+			want = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(want)), "/")
+			if want == rel || want == clean {
+				return i
+			}
+		}
+		return len(priority)
+	}
+
+	hasReadme := func(dir string) bool {
+		for _, p := range byDir[dir] {
+			if strings.HasPrefix(strings.ToLower(filepath.Base(p)), "readme") {
+				return true
+			}
+		}
+		return false
+	}
+
+	sort.SliceStable(dirs, func(a, b int) bool {
+		da, db := dirs[a], dirs[b]
+		if ra, rb := rank(da), rank(db); ra != rb {
+			return ra < rb
+		}
+		switch order {
+		case "count":
+			if ca, cb := len(byDir[da]), len(byDir[db]); ca != cb {
+				return ca > cb
+			}
+		case "readme":
+			if ha, hb := hasReadme(da), hasReadme(db); ha != hb {
+				return ha
+			}
+		}
+		return da < db
+	})
+
+	out := make([]string, 0, len(files))
+	for _, dir := range dirs {
+		out = append(out, byDir[dir]...)
+	}
+	return out
+}
+
+// extGroup is one extension's files for --group-by-ext; ext is "" for files
+// without one.
+type extGroup struct {
+	ext   string
+	files []string
+}
+
+// groupFilesByExt splits files by extension (--group-by-ext). Extensions
+// listed in priority (--ext-order) come first, in that order, then the rest
+// alphabetically, then files without an extension. Files inside a group keep
+// their walk order.
+func groupFilesByExt(files []string, priority []string) []extGroup {
+	byExt := make(map[string][]string)
+	var exts []string
+	for _, p := range files {
+		ext := normalizeExt(filepath.Ext(p))
+		if _, ok := byExt[ext]; !ok {
+			exts = append(exts, ext)
+		}
+		byExt[ext] = append(byExt[ext], p)
+	}
+	rank := func(ext string) int {
+		for i, want := range priority {
+			if normalizeExt(want) == ext {
+				return i
+			}
+		}
+		if ext == "" {
+			return len(priority) + 1
+		}
+		return len(priority)
+	}
+	sort.SliceStable(exts, func(a, b int) bool {
+		if ra, rb := rank(exts[a]), rank(exts[b]); ra != rb {
+			return ra < rb
+		}
+		return exts[a] < exts[b]
+	})
+	groups := make([]extGroup, len(exts))
+	for i, ext := range exts {
+		groups[i] = extGroup{ext: ext, files: byExt[ext]}
+	}
+	return groups
+}
+
+// anyContent reports whether any of loaded has content to emit, so an
+// --group-by-ext group of files stripped to nothing gets no header.
+func anyContent(loaded []loadedFile) bool {
+	for _, lf := range loaded {
+		if lf.content != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGroupByExt rejects --group-by-ext where its group headers would be
+// lost: templates and the JSON formats drop them, and --squash-headers would
+// move them into the file index, away from the contents they open.
+func checkGroupByExt(squash bool, format string, templatePath string) error {
+	switch {
+	case squash:
+		return fmt.Errorf("Error: --group-by-ext can't be combined with --squash-headers")
+	case format != "" && format != "plain" || templatePath != "":
+		return fmt.Errorf("Error: --group-by-ext only applies to the plain format, not --format or --template")
+	}
+	return nil
+}
+
+// extGroupHeader is the plain-format line that opens a --group-by-ext group.
+func extGroupHeader(ext string) string {
+	if ext == "" {
+		return "=== files without an extension ===\n"
+	}
+	return fmt.Sprintf("=== %s files ===\n", ext)
+}
+
 func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  pull <file/dir> ...                         Pull content to clipboard (recursive)")
@@ -528,38 +2392,188 @@ func printUsage() {
 	fmt.Println("  pull https://github.com/<owner>/<repo>/tree/<ref>/<path>   Pull GitHub tree URL (recursive)")
 	fmt.Println("  pull https://github.com/<owner>/<repo>/blob/<ref>/<path>   Pull GitHub blob URL (single file)")
 	fmt.Println("  pull href <url> [url2 ...]                  Fetch URL(s) and copy response to clipboard")
-	fmt.Println("  pull emit                                   Print clipboard content to stdout")
-	fmt.Println("  pull clear                                  Clear clipboard")
-	fmt.Println("  pull write <file>                           Write clipboard to file")
+	fmt.Println("  pull href --check <url> [url2 ...]          Report each URL's status and redirect target; copies nothing")
+	fmt.Println("  pull hash <file/dir> ...                    Print a hash (SHA-256 by default) of what a pull would produce")
+	fmt.Println("  pull list <file/dir> ...                    Print the files a pull would include, one per line")
+	fmt.Println("  pull emit [--out <file>]                    Print clipboard content to stdout (or a file)")
+	fmt.Println("  pull languages                              List known extensions, comment markers, and fence languages")
+	fmt.Println("  pull clear [--yes]                          Clear clipboard (asks first on a terminal)")
+	fmt.Println("  pull push                                   Save the clipboard on top of the clipboard stack")
+	fmt.Println("  pull pop                                    Restore the top of the stack to the clipboard and remove it")
+	fmt.Println("  pull stack list                             Show the clipboard stack, newest first")
+	fmt.Println("  pull split --out <dir>                      Write each file: section in the clipboard back to disk under dir")
+	fmt.Println("  pull registers                              List named registers (--register) and their sizes")
+	fmt.Println("  pull write <file>                           Write clipboard to file (--append to add to it)")
 	fmt.Println("Flags:")
+	fmt.Println("  --mode <perm>                               Permissions for a file created by write/emit --out (default 0644)")
+	fmt.Println("  --on-conflict <policy>                      write/emit --out or split parts over an existing file: overwrite, skip, rename, prompt")
+	fmt.Println("  --stdout                                    Stream output to stdout instead of the clipboard")
+	fmt.Println("  --out <file>                                Stream output to a file instead of the clipboard")
 	fmt.Println("  --append                                    Append to clipboard instead of overwrite")
 	fmt.Println("  --prepend                                   Prepend to clipboard instead of overwrite")
+	fmt.Println("  --warn-size <size>                          On a terminal, ask before copying more than size (default 1M; 0 = never)")
+	fmt.Println("  --clip-type <mime>                          Copy with a MIME type, e.g. text/markdown (wl-copy or xclip)")
+	fmt.Println("  --from-clipboard                            Re-pull the files listed in the clipboard")
+	fmt.Println("  --dedupe-append                             Append, skipping files whose header is already in the clipboard")
+	fmt.Println("  --env-expand                                Expand $VAR, ${VAR}, and a leading ~ in path arguments")
+	fmt.Println("  --manifest-out <file>                       Write the hash of every local file read to a manifest")
+	fmt.Println("  --hash-algo <algo>                          Hash for hash, --manifest-out, --only-new: sha256, sha1, blake3, or git")
+	fmt.Println("  --only-new <manifest>                       Pull only files that are new or changed since the manifest")
+	fmt.Println("  --error-format <text|json>                  Write warnings and errors on stderr as JSON lines")
+	fmt.Println("  --verbose, -v                               Report extra details (such as --env-expand results) on stderr")
+	fmt.Println("  --strict                                    Fail if --append/--prepend cannot read the clipboard")
+	fmt.Println("  --quiet, -q                                 Suppress warnings")
+	fmt.Println("  --register <name>                           Use a named register on disk instead of the system clipboard")
+	fmt.Println("  --clipboard-timeout <duration>              Give up on a clipboard backend that hangs (default 10s, 0 = wait forever)")
+	fmt.Println("  --progress-json                             Stream JSON progress events (one per file, then done) to stderr")
+	fmt.Println("  --retry-clipboard                           Retry a failed clipboard write, then save the pull to a temp file")
+	fmt.Println("  --selection <clipboard|primary>             Clipboard selection to use (Linux/BSD)")
+	fmt.Println("  --yes, -y                                   Skip confirmation prompts")
 	fmt.Println("  --includeIgnore                             Include files that are ignored by .gitignore")
+	fmt.Println("  --respect-core-excludesfile-config          Also ignore what git's core.excludesFile lists")
+	fmt.Println("  --include-hidden                            Include dotfiles and dot-directories")
+	fmt.Println("  --include-vcs                               Walk .git/.hg/.svn too (requires --includeIgnore)")
+	fmt.Println("  --ignore-symlinks                           Skip symlinked files while walking")
+	fmt.Println("  --include-binary                            Include files detected as binary")
+	fmt.Println("  --respect-binary-gitattributes              Use .gitattributes (binary, -text) to decide what is binary")
 	fmt.Println("  --sample                                    Sample 2-3 files per directory")
+	fmt.Println("  --skip-outliers <n>                         Skip files over n times the median file size of each start path")
 	fmt.Println("  --sample-min <n>                            Minimum files per directory when sampling")
 	fmt.Println("  --sample-max <n>                            Maximum files per directory when sampling")
+	fmt.Println("  --format <plain|md|json|jsonl|xml>          Output format (default plain)")
+	fmt.Println("  --follow <file>                             Keep the last lines of a growing file in the clipboard, like tail -f")
+	fmt.Println("  --lines <n>                                 Lines --follow keeps in the clipboard (default 100)")
+	fmt.Println("  --sandbox-root <dir>                        Refuse to read or write any file outside dir")
+	fmt.Println("  --resolve-symlinks                          Show the real location of symlinked files in headers")
+	fmt.Println("  --path-style <posix|windows|native>         Separators for paths in headers (default posix)")
+	fmt.Println("  --json-pretty                               Indent --format json for reading (same as --json-indent 2)")
+	fmt.Println("  --json-indent <n>                           Indent --format json by n spaces; 0 puts it on one line")
+	fmt.Println("  --template <file>                           Render output with a Go text/template")
+	fmt.Println("  --no-header                                 Leave out file:/href: headers; files are separated by a blank line")
+	fmt.Println("  --dedupe-content                            Pull repeated file contents once; later copies only reference the first")
+	fmt.Println("  --file-separator <string>                   Write string between consecutive files (\\n and \\t are expanded)")
+	fmt.Println("  --merge-adjacent <size>                     Put runs of files up to size bytes in one section with // file: markers")
+	fmt.Println("  --squash-headers                            List files once at the top instead of a header per file")
+	fmt.Println("  --truncate-long-lines <n>                   Cut lines longer than n characters")
+	fmt.Println("  --strip-comments[=false]                    Drop comment lines (default true)")
+	fmt.Println("  --strip-blank[=false]                       Drop blank lines (default true)")
+	fmt.Println("  --wrap <cols>                               Hard-wrap prose (.md, .txt, href pages) at cols characters")
+	fmt.Println("  --wrap-all                                  With --wrap, wrap code files too")
+	fmt.Println("  --strip-logs                                Drop single-line logging calls (log., fmt.Print, console., print(, ...)")
+	fmt.Println("  --strip-logs-pattern <regex>                Also drop lines matching regex (repeatable; implies --strip-logs)")
+	fmt.Println("  --content-filter <regex>                    Drop every line matching regex from every file (repeatable)")
+	fmt.Println("  --grep-mark <regex>                         Pull only files with a matching line, bracketing the matches (repeatable)")
+	fmt.Println("  --comments-only                             Keep only comment lines instead of dropping them")
+	fmt.Println("  --normalize-unicode <nfc|nfd|nfkc|nfkd>     Normalize the output to one Unicode normalization form")
+	fmt.Println("  --null, -0                                  list: end each path with a NUL byte instead of a newline")
+	fmt.Println("  --sizes                                     list: print each file's size in bytes before its path")
+	fmt.Println("  --normalize-quotes                          Turn typographic quotes into straight ASCII quotes")
+	fmt.Println("  --ascii-only                                Replace non-ASCII characters (smart quotes, zero-width spaces, ...)")
+	fmt.Println("  --ascii-mode <replace|strip|report>         How --ascii-only treats them; report only lists where they are")
+	fmt.Println("  --max-line-count <n>                        Skip files with more than n lines (generated code, bundles)")
+	fmt.Println("  --trim-trailing-whitespace                  Strip trailing spaces and tabs from every line")
+	fmt.Println("  --redact-strings                            Replace the contents of string literals with \"...\"")
+	fmt.Println("  --trim-file-edges                           Drop blank lines at the start and end of each file, keeping inner ones")
+	fmt.Println("  --comment-marker-detect                     Choose comment markers per file from its shebang, mode line, extension, or name")
+	fmt.Println("  --fail-on-empty                             Exit non-zero instead of copying when nothing with content was pulled")
+	fmt.Println("  --fail-on-empty-mode <content|matched>      With matched, fail only when no file matched the filters at all")
+	fmt.Println("  --include-empty                             Keep headers for files that are empty after stripping or unreadable")
+	fmt.Println("  --ext <go,md>                               Only include files with these extensions")
+	fmt.Println("  --infer-ext                                 Only include the most common extension (ignored with --ext)")
+	fmt.Println("  --prepend-tree                              Start the output with a filetree: list of every pulled file")
+	fmt.Println("  --append-summary                            End the output with a summary: line of file, byte, line, and token totals")
+	fmt.Println("  --count                                     Print file, byte, line, and token totals to stderr")
+	fmt.Println("  --count-only                                Like --count, but only count: nothing is copied or written")
+	fmt.Println("  --count-per-file                            Print each file's bytes, lines, and tokens to stderr, largest first")
+	fmt.Println("  --count-tokens-model <model>                Count tokens exactly with a model's tokenizer (e.g. gpt-4o)")
+	fmt.Println("  --model <model>                             Model for token counts and --estimate-cost, without implying --count")
+	fmt.Println("  --estimate-cost                             Print the input cost of sending the pull to --model")
+	fmt.Println("  --summarize                                 Send the pull to an LLM and deliver its summary instead")
+	fmt.Println("  --summary-model <model>                     Model for --summarize (default gpt-4o-mini, or $PULL_SUMMARY_MODEL)")
+	fmt.Println("  --summary-base-url <url>                    OpenAI-compatible API base URL for --summarize")
+	fmt.Println("  --summary-prompt <text>                     System prompt for --summarize")
+	fmt.Println("  --text                                      href: convert HTML to text, dropping scripts, styles, and comments")
+	fmt.Println("  --follow-next                               href: also fetch the pages a Link: rel=\"next\" header or <link rel=next> points to")
+	fmt.Println("  --max-pages <n>                             href: stop --follow-next after n pages per URL (default 10)")
+	fmt.Println("  --user <user[:password]>                    href: HTTP basic auth; prompts for the password when left out")
+	fmt.Println("  --readability                               href: like --text, keeping only the <main>/<article> content")
+	fmt.Println("  --raw                                       href: copy the response body byte for byte, with no header")
+	fmt.Println("  --code-blocks                               href: pull only the page's code samples, one section each")
+	fmt.Println("  --jq <filter>                               href: copy only part of a JSON response (a jq expression)")
+	fmt.Println("  --jq-non-json <error|pass>                  href --jq: fail on a response that isn't JSON, or copy it as is")
+	fmt.Println("  --timeout <duration>                        HTTP timeout for href (default 15s)")
+	fmt.Println("  --retries <n>                               Retry href requests after network errors, 429s, and 5xx responses")
+	fmt.Println("  --exclude <pattern>                         Skip paths matching a gitignore-style pattern (repeatable)")
+	fmt.Println("  --pre-walk <command>                        Run a shell command before reading any files; its failure aborts the pull")
+	fmt.Println("  --post-write <command>                      Run a shell command after the output has been delivered")
+	fmt.Println("  --chdir <dir>                               Change to dir before doing anything else, as if run from there")
+	fmt.Println("  --include-from <file>                       Only pull paths matching a gitignore-style pattern in file (repeatable)")
+	fmt.Println("  --git-tracked-only                          Pull exactly the files git tracks (git ls-files) instead of walking")
+	fmt.Println("  --untracked-only                            Pull only untracked, unignored files (git ls-files --others)")
+	fmt.Println("  --modified-only                             Pull only files with uncommitted changes (git status)")
+	fmt.Println("  --exclude-tests                             Skip test files (*_test.go, *.test.ts, test_*.py, ...)")
+	fmt.Println("  --only-tests                                Pull only test files")
+	fmt.Println("  --filter-order <layers>                     Order of the gitignore, exclude, include, tests, and ext filters; the first with an opinion wins")
+	fmt.Println("  --dedent                                    Remove the indentation every line of a file shares")
+	fmt.Println("  --reindent <spaces[=N]|tabs>                Rewrite leading indentation as N spaces (default 4) or one tab per level")
+	fmt.Println("  --respect-editorconfig                      Take each file's indent size and style from .editorconfig for --reindent")
+	fmt.Println("  --split-by-size <size>                      Write pull-part-NNN.txt files of at most size bytes (e.g. 100k)")
+	fmt.Println("  --split-by-tokens <n>                       Like --split-by-size, measured in tokens")
+	fmt.Println("  --interactive-split                         Copy each part to the clipboard in turn instead of writing files")
+	fmt.Println("  --workers <n>                               Read files with n parallel workers (large pulls only)")
+	fmt.Println("  --respect-gitignore-cache, --cache          Reuse the file list of an unchanged tree from the last walk")
+	fmt.Println("  --refresh                                   Like --cache, but walk again and store the fresh result")
+	fmt.Println("  --no-cache                                  Don't use the walk cache, even with --cache")
+	fmt.Println("  --group-by-dir                              Keep files clustered by directory")
+	fmt.Println("  --dir-order <alpha|count|readme>            Order of directory groups (implies --group-by-dir)")
+	fmt.Println("  --dir-priority <dir1,dir2>                  Directory groups to emit first (implies --group-by-dir)")
+	fmt.Println("  --group-by-ext                              Emit files grouped by extension, each group under a === .ext files === line")
+	fmt.Println("  --ext-order <go,sql>                        Extension groups to emit first (implies --group-by-ext)")
 	fmt.Println("")
 	fmt.Println("GitHub auth (recommended):")
 	fmt.Println("  export GITHUB_TOKEN=ghp_...   (or fine-grained token with repo read access)")
 }
 
-func loadGitIgnoreForCWD() (root string, ign *gitignore.GitIgnore) {
-	cwd, err := os.Getwd()
+// loadGitIgnoreFor finds the repository containing startPath and compiles its
+// root .gitignore. Discovery starts from the path itself rather than the
+// working directory, so a path in another repo is matched against that repo's
+// rules.
+func loadGitIgnoreFor(startPath string, global bool) (root string, ign *gitignore.GitIgnore) {
+	dir, err := filepath.Abs(startPath)
 	if err != nil {
 		return "", nil
 	}
-	root, err = findRepoRoot(cwd)
+	if !existsDir(dir) {
+		dir = filepath.Dir(dir)
+	}
+	root, err = findRepoRoot(dir)
 	if err != nil || root == "" {
 		return "", nil
 	}
+	return root, compileRootGitIgnore(root, global)
+}
 
+// compileRootGitIgnore compiles root's .gitignore. With global, the patterns
+// of the user's core.excludesFile come first, so the repository's own rules
+// (including negations) take precedence over them, as in git.
+func compileRootGitIgnore(root string, global bool) *gitignore.GitIgnore {
 	giPath := filepath.Join(root, ".gitignore")
+	if global {
+		lines := globalExcludeLines(root)
+		if local, err := readPatternFile(giPath); err == nil {
+			lines = append(lines, local...)
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		return gitignore.CompileIgnoreLines(lines...)
+	}
 	if _, err := os.Stat(giPath); err == nil {
 		if m, err := gitignore.CompileIgnoreFile(giPath); err == nil {
-			return root, m
+			return m
 		}
 	}
-	return root, nil
+	return nil
 }
 
 func findRepoRoot(start string) (string, error) {
@@ -569,7 +2583,7 @@ func findRepoRoot(start string) (string, error) {
 	}
 	dir := start
 	for {
-		if existsDir(filepath.Join(dir, ".git")) || existsFile(filepath.Join(dir, ".gitignore")) {
+		if isRepoDir(dir) || existsFile(filepath.Join(dir, ".gitignore")) {
 			return dir, nil
 		}
 		parent := filepath.Dir(dir)
@@ -595,6 +2609,16 @@ func isIgnored(repoRoot string, ign *gitignore.GitIgnore, p string) bool {
 	if ign == nil || repoRoot == "" {
 		return false
 	}
+	rel, ok := repoRelPath(repoRoot, p)
+	if !ok {
+		return false
+	}
+	return ign.MatchesPath(rel)
+}
+
+// repoRelPath returns p relative to repoRoot in slash form. ok is false when p
+// lies outside the repo.
+func repoRelPath(repoRoot string, p string) (string, bool) {
 	absRoot, err := filepath.Abs(repoRoot)
 	if err != nil {
 		absRoot = repoRoot
@@ -605,13 +2629,12 @@ func isIgnored(repoRoot string, ign *gitignore.GitIgnore, p string) bool {
 	}
 	rel, err := filepath.Rel(absRoot, absPath)
 	if err != nil {
-		return false
+		return "", false
 	}
 	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-		return false
+		return "", false
 	}
-	rel = filepath.ToSlash(rel)
-	return ign.MatchesPath(rel)
+	return filepath.ToSlash(rel), true
 }
 
 //
@@ -752,15 +2775,15 @@ func (c *ghClient) do(req *http.Request) (*http.Response, error) {
 	return c.http.Do(req)
 }
 
-func fetchGitHubSpecIntoBuilder(spec gitHubSpec, sb *strings.Builder) error {
+func fetchGitHubSpecIntoBuilder(spec gitHubSpec, out *emitter) error {
 	c := newGHClient()
 
 	// Label the operation (useful when mixing local + github).
-	sb.WriteString(fmt.Sprintf("github: %s\n", spec.Label))
+	out.note(fmt.Sprintf("github: %s\n", spec.Label))
 
 	// If user provided a blob URL path but no file extension… still handled by contents API.
 	// We’ll resolve the spec target via contents API and recurse if it’s a directory.
-	return c.walkContents(spec.Owner, spec.Repo, spec.Ref, spec.Path, sb)
+	return c.walkContents(spec.Owner, spec.Repo, spec.Ref, spec.Path, out)
 }
 
 type ghContentItem struct {
@@ -772,7 +2795,7 @@ type ghContentItem struct {
 	DownloadURL string `json:"download_url"`
 }
 
-func (c *ghClient) walkContents(owner, repo, ref, repoPath string, sb *strings.Builder) error {
+func (c *ghClient) walkContents(owner, repo, ref, repoPath string, out *emitter) error {
 	// Query /repos/{owner}/{repo}/contents/{path}?ref=
 	endpoint := fmt.Sprintf("%s/repos/%s/%s/contents", githubAPIRoot, owner, repo)
 	if repoPath != "" {
@@ -833,11 +2856,11 @@ func (c *ghClient) walkContents(owner, repo, ref, repoPath string, sb *strings.B
 		for _, it := range items {
 			switch it.Type {
 			case "dir":
-				if err := c.walkContents(owner, repo, ref, it.Path, sb); err != nil {
+				if err := c.walkContents(owner, repo, ref, it.Path, out); err != nil {
 					return err
 				}
 			case "file":
-				if err := c.fetchFileRaw(owner, repo, ref, it.Path, sb); err != nil {
+				if err := c.fetchFileRaw(owner, repo, ref, it.Path, out); err != nil {
 					return err
 				}
 			default:
@@ -856,15 +2879,15 @@ func (c *ghClient) walkContents(owner, repo, ref, repoPath string, sb *strings.B
 
 	switch single.Type {
 	case "dir":
-		return c.walkContents(owner, repo, ref, single.Path, sb)
+		return c.walkContents(owner, repo, ref, single.Path, out)
 	case "file":
-		return c.fetchFileRaw(owner, repo, ref, single.Path, sb)
+		return c.fetchFileRaw(owner, repo, ref, single.Path, out)
 	default:
 		return fmt.Errorf("github: unsupported content type %q at %s/%s:%s", single.Type, owner, repo, repoPath)
 	}
 }
 
-func (c *ghClient) fetchFileRaw(owner, repo, ref, repoPath string, sb *strings.Builder) error {
+func (c *ghClient) fetchFileRaw(owner, repo, ref, repoPath string, out *emitter) error {
 	// Use the contents endpoint with the "raw" media type so we get file bytes directly.
 	endpoint := fmt.Sprintf("%s/repos/%s/%s/contents/%s", githubAPIRoot, owner, repo, escapeGitHubPath(repoPath))
 
@@ -912,22 +2935,18 @@ func (c *ghClient) fetchFileRaw(owner, repo, ref, repoPath string, sb *strings.B
 	}
 	label = label + "/" + repoPath
 
-	sb.WriteString(fmt.Sprintf("file: %s\n", label))
-
 	// Keep your existing behavior: skip empty lines + comment-only lines.
-	scanner := bufio.NewScanner(bytes.NewReader(b))
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmed := strings.TrimSpace(line)
-		if len(trimmed) == 0 {
-			continue
-		}
-		if strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") {
-			continue
-		}
-		sb.WriteString(line)
-		sb.WriteString("\n")
+	content := stripContent(bytes.NewReader(b), repoPath, out.strip)
+	if content == "" && !out.includeEmpty {
+		return nil
 	}
+	out.file(fileRecord{
+		Path:    label,
+		RelPath: repoPath,
+		Content: content,
+		Ext:     normalizeExt(path.Ext(repoPath)),
+		header:  "file",
+	})
 	return nil
 }
 
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"example.com", "https://example.com"},
+		{"example.com/docs?q=1", "https://example.com/docs?q=1"},
+		{"[::1]:8080", "https://[::1]:8080"},
+		{"[2001:db8::1]/x", "https://[2001:db8::1]/x"},
+		{"::1", "https://[::1]"},
+		{"https://example.com", "https://example.com"},
+		{"http://[::1]:8080/x", "http://[::1]:8080/x"},
+		{"  https://example.com/a  ", "https://example.com/a"},
+		{"localhost:3000", "https://localhost:3000"},
+		{"ftp://x", "ftp://x"},
+		{"file:///tmp/a.txt", "file:///tmp/a.txt"},
+		{"user@host/path", "https://user@host/path"},
+	}
+	for _, tt := range tests {
+		if got := normalizeURL(tt.in); got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFindRepoRootGitFile(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A worktree: .git is a file pointing at a git directory elsewhere.
+	mainGit := filepath.Join(tmp, "main", ".git")
+	wt := filepath.Join(tmp, "wt")
+	start := filepath.Join(wt, "pkg", "sub")
+	for _, d := range []string{filepath.Join(mainGit, "worktrees", "wt"), start} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(wt, ".git"), []byte("gitdir: ../main/.git/worktrees/wt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := findRepoRoot(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != wt {
+		t.Errorf("findRepoRoot(%q) = %q, want %q", start, root, wt)
+	}
+	dir, ok := gitDir(root)
+	if want := filepath.Join(mainGit, "worktrees", "wt"); !ok || dir != want {
+		t.Errorf("gitDir(%q) = %q, %v, want %q", root, dir, ok, want)
+	}
+}
+
+func TestCheckGroupByExt(t *testing.T) {
+	tests := []struct {
+		name         string
+		squash       bool
+		format       string
+		templatePath string
+		ok           bool
+	}{
+		{"plain", false, "", "", true},
+		{"explicit plain", false, "plain", "", true},
+		{"squash-headers", true, "", "", false},
+		{"md", false, "md", "", false},
+		{"jsonl", false, "jsonl", "", false},
+		{"template", false, "", "out.tmpl", false},
+	}
+	for _, tt := range tests {
+		err := checkGroupByExt(tt.squash, tt.format, tt.templatePath)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: checkGroupByExt error = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCommentOnlyFileHasNoHeader(t *testing.T) {
+	dir := t.TempDir()
+	comments := filepath.Join(dir, "doc.go")
+	code := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(comments, []byte("// Package doc is all comments.\n\n// Nothing else.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(code, []byte("// main runs.\npackage main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, includeEmpty := range []bool{false, true} {
+		var buf bytes.Buffer
+		out := newEmitter(&buf, outputOptions{includeEmpty: includeEmpty})
+		for _, p := range []string{comments, code} {
+			emitLoaded(out, loadFile(p, out.strip))
+		}
+		if err := out.finish(); err != nil {
+			t.Fatal(err)
+		}
+		got := buf.String()
+		if hasHeader := strings.Contains(got, "file: "+comments); hasHeader != includeEmpty {
+			t.Errorf("includeEmpty=%v: header for the comment-only file present=%v in %q", includeEmpty, hasHeader, got)
+		}
+		if !strings.Contains(got, "file: "+code+"\npackage main\n") {
+			t.Errorf("includeEmpty=%v: code file missing from %q", includeEmpty, got)
+		}
+	}
+}
+
+func TestTrimTrailingSkipsLocalHref(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "page.txt")
+	if err := os.WriteFile(p, []byte("kept  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	out := newEmitter(&buf, outputOptions{strip: stripOptions{trimTrailing: true}})
+	if err := readLocalIntoBuilder(p, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "kept  \n") {
+		t.Errorf("href content was trimmed: %q", buf.String())
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(target, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A hard link keeps the original inode reachable: if the new content
+	// were written in place, the link would see it (or a truncated mix).
+	alias := filepath.Join(dir, "alias")
+	if err := os.Link(target, alias); err != nil {
+		t.Skipf("hard links unavailable: %v", err)
+	}
+	if err := writeFileAtomic(target, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(target); string(b) != "new\n" {
+		t.Errorf("target = %q, want %q", b, "new\n")
+	}
+	if b, _ := os.ReadFile(alias); string(b) != "old\n" {
+		t.Errorf("original inode = %q, want it untouched", b)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
+
+func TestWriteFileAtomicFailureKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	// Renaming a file over a non-empty directory fails after the temp file
+	// has been written; what was there must survive, with no temp file left.
+	target := filepath.Join(dir, "target")
+	writeTree(t, dir, map[string]string{"target/keep.txt": "old\n"})
+	if err := writeFileAtomic(target, []byte("new\n"), 0o644); err == nil {
+		t.Fatal("writeFileAtomic over a directory succeeded")
+	}
+	if b, _ := os.ReadFile(filepath.Join(target, "keep.txt")); string(b) != "old\n" {
+		t.Errorf("original content = %q after a failed write", b)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
+
+func TestWriteKeepsExecutableBit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bit on Windows")
+	}
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	reg, err := newRegisterSink("script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(reg, "#!/bin/sh\necho new\n")
+	if err := reg.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(existing, []byte("#!/bin/sh\necho old\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fresh := filepath.Join(dir, "new.sh")
+	opts := writeOptions{onConflict: conflictOverwrite, mode: 0o644, register: "script"}
+	captured := captureStdout(t)
+	writeClipboardToFile(existing, opts)
+	writeClipboardToFile(fresh, opts)
+	captured()
+
+	for p, want := range map[string]os.FileMode{existing: 0o755, fresh: 0o644} {
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %v, want %v", filepath.Base(p), got, want)
+		}
+		if b, _ := os.ReadFile(p); string(b) != "#!/bin/sh\necho new\n" {
+			t.Errorf("%s = %q", filepath.Base(p), b)
+		}
+	}
+}
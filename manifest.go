@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifest maps absolute paths to the hex digest (--hash-algo) of their raw
+// content. On disk it uses sha256sum's "<hash>  <path>" line format.
+type manifest map[string]string
+
+func readManifest(p string) (manifest, error) {
+	if err := checkSandbox(p); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("Error: reading manifest: %v", err)
+	}
+	defer f.Close()
+
+	m := make(manifest)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxScanLine)
+	for scanner.Scan() {
+		sum, path, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || sum == "" || path == "" {
+			continue
+		}
+		m[path] = sum
+	}
+	return m, scanner.Err()
+}
+
+func (m manifest) write(p string) error {
+	if err := checkSandbox(p); err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&sb, "%s  %s\n", m[path], path)
+	}
+	if dir := filepath.Dir(p); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("Error creating directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(p, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("Error: writing manifest: %v", err)
+	}
+	return nil
+}
+
+// changeTracker backs --only-new and --manifest-out. It records the hash of
+// every local file the pull reads and, with a previous manifest, reports
+// which ones changed.
+type changeTracker struct {
+	prev manifest // nil without --only-new
+	next manifest
+}
+
+func newChangeTracker(prev manifest) *changeTracker {
+	return &changeTracker{prev: prev, next: make(manifest)}
+}
+
+// observe records p's hash and reports whether p should be emitted: always
+// without a previous manifest, otherwise only when it is new or changed.
+func (t *changeTracker) observe(p string, sum string) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		abs = p
+	}
+	t.next[abs] = sum
+	if t.prev == nil {
+		return true
+	}
+	old, ok := t.prev[abs]
+	return !ok || old != sum
+}
+
+// deleted lists the paths in the previous manifest that no longer exist.
+func (t *changeTracker) deleted() []string {
+	var gone []string
+	for p := range t.prev {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			gone = append(gone, p)
+		}
+	}
+	sort.Strings(gone)
+	return gone
+}
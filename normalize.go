@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizationForms are the --normalize-unicode values.
+var normalizationForms = map[string]norm.Form{
+	"nfc":  norm.NFC,
+	"nfd":  norm.NFD,
+	"nfkc": norm.NFKC,
+	"nfkd": norm.NFKD,
+}
+
+// normSink decorates a sink with --normalize-unicode. The norm writer buffers
+// across calls until a normalization boundary, so Close must flush it.
+type normSink struct {
+	sink
+	w io.WriteCloser
+}
+
+func newNormSink(inner sink, form norm.Form) *normSink {
+	return &normSink{sink: inner, w: form.Writer(inner)}
+}
+
+func (s *normSink) Write(p []byte) (int, error) { return s.w.Write(p) }
+
+func (s *normSink) Close() error {
+	if err := s.w.Close(); err != nil {
+		return err
+	}
+	return s.sink.Close()
+}
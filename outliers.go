@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+// minOutlierSample is how many files --skip-outliers needs before a median
+// means anything; smaller sets are left alone.
+const minOutlierSample = 3
+
+// dropOutliers removes the files larger than multiple times the median size
+// of files (--skip-outliers), reporting each one it drops. Sizes come from a
+// stat of every candidate before any file is read.
+func dropOutliers(files []string, multiple float64) []string {
+	if len(files) < minOutlierSample {
+		return files
+	}
+	sizes := make([]int64, len(files))
+	for i, p := range files {
+		if st, err := os.Stat(p); err == nil {
+			sizes[i] = st.Size()
+		}
+	}
+	sorted := append([]int64(nil), sizes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	if median == 0 {
+		verbosef("--skip-outliers: the median file is empty; keeping every file\n")
+		return files
+	}
+	limit := float64(median) * multiple
+	kept := files[:0:0]
+	for i, p := range files {
+		if float64(sizes[i]) > limit {
+			infof("Skipped outlier %s (%d bytes, %.1fx the median of %d bytes)\n", p, sizes[i], float64(sizes[i])/float64(median), median)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
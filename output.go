@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// fileRecord is one pulled file (or fetched URL) as seen by output templates.
+type fileRecord struct {
+	Path    string // absolute path, github.com/... label, or URL
+	RelPath string // path relative to the working directory or repository
+	Content string // content after stripping
+	Size    int    // len(Content) in bytes
+	Ext     string // normalized extension, e.g. ".go"
+	Lang    string // Markdown fence language, from the extension, name, or shebang
+
+	SameAs string // with --dedupe-content, the earlier file this one repeats; Content is then empty
+
+	header string // plain-format header keyword: "file" or "href"
+	code   bool   // a code sample from a page (href --code-blocks), never prose
+	note   bool   // a note held in order with squashed files; Content is its text
+}
+
+// outputOptions are the flags that shape how pulled files are rendered.
+type outputOptions struct {
+	tmpl         *template.Template // nil for the plain and jsonl formats
+	jsonl        bool               // one JSON object per file, streamed (--format jsonl)
+	jsonEncoded  bool               // --format json via encoding/json (--json-pretty, --json-indent)
+	jsonIndent   int                // its indent in spaces; 0 puts it all on one line
+	includeEmpty bool               // emit files even when there's nothing to show
+	strip        stripOptions
+	squash       bool           // one file index up front instead of a header per file
+	noHeader     bool           // no file:/href: headers; files separated by a blank line
+	separator    string         // written between consecutive file sections (--file-separator)
+	dedupe       bool           // reference repeated file contents instead of repeating them (--dedupe-content)
+	raw          bool           // contents exactly as they are: no headers, notes, or added newlines (href --raw)
+	mergeSmall   int            // combine runs of files up to this many bytes (--merge-adjacent)
+	wrap         int            // hard-wrap prose at this many columns (--wrap); 0 = off
+	wrapAll      bool           // --wrap code files too (--wrap-all)
+	pathStyle    string         // separators for local paths shown in headers (--path-style)
+	resolveLinks bool           // show local paths with symlinks resolved (--resolve-symlinks)
+	counter      *tokenCounter  // non-nil tallies stats (--count, --append-summary)
+	price        *modelPrice    // non-nil prints an --estimate-cost line
+	countReport  bool           // print the stats to stderr on finish (--count)
+	countFiles   bool           // print a per-file breakdown on finish (--count-per-file)
+	countOnly    bool           // tally stats and drop the content (--count-only)
+	changes      *changeTracker // non-nil with --only-new or --manifest-out
+
+	// Sections around the files, plain format only. The new content is laid
+	// out as tree, files, summary; --append/--prepend then place all of it
+	// after or before the existing content.
+	prependTree   bool
+	appendSummary bool
+}
+
+// emitter receives pulled content and renders it to w. With no template it
+// writes the plain (or jsonl) format as files arrive, so stdout and file
+// destinations stream; templates and squashed headers buffer records until
+// finish.
+type emitter struct {
+	outputOptions
+	w       io.Writer
+	records []fileRecord
+
+	// skip holds header lines already present in appended-to content
+	// (--dedupe-append); deduped counts the sections dropped because of it.
+	skip    map[string]bool
+	deduped int
+
+	// firstWith maps a content digest to the first file with that content
+	// (--dedupe-content); collapsed counts the files that referenced one.
+	firstWith map[[sha256.Size]byte]string
+	collapsed int
+
+	redacted int // string literals blanked by --redact-strings
+	marked   int // --grep-mark runs bracketed
+
+	stats pullStats
+
+	written int // plain-format file sections written so far
+
+	// progressFiles and progressBytes total what was added, for the
+	// --progress-json done event.
+	progressFiles int
+	progressBytes int
+
+	// merging holds a run of small files for --merge-adjacent until a larger
+	// file, a note, or the end of the pull closes it.
+	merging []fileRecord
+
+	// matched counts local files that passed the filters; nonEmpty counts
+	// records with content. Both back --fail-on-empty.
+	matched  int
+	nonEmpty int
+
+	// With --prepend-tree the files are held in body until the tree, which
+	// needs every path, has been written to final.
+	final io.Writer
+	body  *bytes.Buffer
+	paths []string
+}
+
+func newEmitter(w io.Writer, opts outputOptions) *emitter {
+	e := &emitter{outputOptions: opts, w: w, final: w}
+	e.stats.perFile = opts.countFiles
+	if e.prependTree && e.plain() {
+		e.body = &bytes.Buffer{}
+		e.w = e.body
+	}
+	return e
+}
+
+// plain reports whether the output is the plain format (squashed or not),
+// the only one with room for free-form sections.
+func (e *emitter) plain() bool {
+	return e.tmpl == nil && !e.jsonl && !e.jsonEncoded
+}
+
+// skipHeadersIn records every file:/href: header line in existing (including
+// --merge-adjacent markers) so sections with the same header are not emitted
+// again.
+func (e *emitter) skipHeadersIn(existing string) {
+	e.skip = make(map[string]bool)
+	for _, line := range strings.Split(existing, "\n") {
+		line = strings.TrimPrefix(strings.TrimRight(line, "\r"), "// ")
+		if strings.HasPrefix(line, "file: ") || strings.HasPrefix(line, "href: ") {
+			line, _ = splitDedupedPath(line)
+			e.skip[line] = true
+		}
+	}
+}
+
+func (e *emitter) file(rec fileRecord) {
+	if rec.header == "file" {
+		rec.Lang = langFor(rec)
+		if e.resolveLinks {
+			rec.Path = resolvedPath(rec.Path)
+		}
+		rec.Path = styledPath(rec.Path, e.pathStyle)
+	}
+	if e.skip[rec.header+": "+rec.Path] {
+		e.deduped++
+		return
+	}
+	if e.wrap > 0 && !e.raw && (e.wrapAll || (rec.header == "href" && !rec.code) || proseExts[rec.Ext]) {
+		rec.Content = wrapText(rec.Content, e.wrap)
+	}
+	rec.Size = len(rec.Content)
+	if rec.Lang == "" && !rec.code {
+		rec.Lang = langFor(rec)
+	}
+	if rec.Size > 0 {
+		e.nonEmpty++
+		if e.dedupe && rec.header == "file" {
+			e.dedupeRecord(&rec)
+		}
+	}
+	if e.body != nil {
+		e.paths = append(e.paths, rec.Path)
+	}
+	if e.counter != nil {
+		e.stats.add(rec, e.counter)
+	}
+	e.progressFiles++
+	e.progressBytes += rec.Size
+	emitProgress(progressFileEvent{Event: "file", Path: rec.Path, Bytes: rec.Size})
+	if e.countOnly {
+		return
+	}
+	if e.jsonl {
+		e.writeJSONLine(rec)
+		return
+	}
+	if e.tmpl != nil || e.squash || e.jsonEncoded {
+		e.records = append(e.records, rec)
+		return
+	}
+	if e.mergeSmall > 0 && !e.noHeader && !e.raw {
+		if rec.Size <= e.mergeSmall {
+			e.merging = append(e.merging, rec)
+			return
+		}
+		e.flushMerged()
+	}
+	e.writeSection(rec)
+}
+
+// dedupeRecord empties rec and points it at the first file with the same
+// content, if there was one; otherwise it remembers rec as that first file.
+func (e *emitter) dedupeRecord(rec *fileRecord) {
+	if e.firstWith == nil {
+		e.firstWith = make(map[[sha256.Size]byte]string)
+	}
+	sum := sha256.Sum256([]byte(rec.Content))
+	first, ok := e.firstWith[sum]
+	if !ok {
+		e.firstWith[sum] = rec.Path
+		return
+	}
+	rec.SameAs, rec.Content, rec.Size = first, "", 0
+	e.collapsed++
+}
+
+// headerLine is a plain-format header, noting the original of a deduped file.
+func headerLine(rec fileRecord) string {
+	if rec.SameAs != "" {
+		return fmt.Sprintf("%s: %s (identical to %s)", rec.header, rec.Path, rec.SameAs)
+	}
+	return rec.header + ": " + rec.Path
+}
+
+// splitDedupedPath splits a header path written by headerLine back into the
+// file's path and the path it is identical to ("" when it isn't a reference).
+func splitDedupedPath(p string) (string, string) {
+	i := strings.LastIndex(p, " (identical to ")
+	if i < 0 || !strings.HasSuffix(p, ")") {
+		return p, ""
+	}
+	return p[:i], p[i+len(" (identical to ") : len(p)-1]
+}
+
+// langFor detects rec's fence language from its name and first line.
+func langFor(rec fileRecord) string {
+	first, _, _ := strings.Cut(rec.Content, "\n")
+	return fenceLanguage(detectLanguage(rec.Path, first))
+}
+
+// resolvedPath returns p with every symlink in it resolved, the way
+// findRepoRoot sees it. Paths that can't be resolved, such as GitHub labels,
+// are returned as they are.
+func resolvedPath(p string) string {
+	if !filepath.IsAbs(p) {
+		return p
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return p
+	}
+	return real
+}
+
+// --path-style values.
+const (
+	pathPosix   = "posix"   // forward slashes everywhere (the default)
+	pathWindows = "windows" // backslashes everywhere
+	pathNative  = "native"  // whatever this OS uses
+)
+
+// styledPath renders a local path with the separators of style. posix
+// converts only this OS's separator, since a backslash is an ordinary file
+// name character on Unix.
+func styledPath(p string, style string) string {
+	switch style {
+	case pathPosix:
+		return filepath.ToSlash(p)
+	case pathWindows:
+		return strings.ReplaceAll(filepath.ToSlash(p), "/", `\`)
+	}
+	return p
+}
+
+// flushMerged writes the held run of small files. A run of one is written as
+// a normal section; longer runs become one "merged:" section in which each
+// file starts with a "// file: <path>" marker line.
+func (e *emitter) flushMerged() {
+	run := e.merging
+	e.merging = nil
+	if len(run) == 1 {
+		e.writeSection(run[0])
+		return
+	}
+	if len(run) == 0 {
+		return
+	}
+	e.writeSeparator()
+	io.WriteString(e.w, "merged:\n")
+	for _, rec := range run {
+		fmt.Fprintf(e.w, "// %s\n", headerLine(rec))
+		io.WriteString(e.w, rec.Content)
+	}
+	e.written++
+}
+
+// writeSection writes one plain-format file section: its header and content,
+// or with --no-header the content alone after a blank line from the previous
+// section. A --file-separator takes the place of that blank line.
+func (e *emitter) writeSection(rec fileRecord) {
+	if e.raw {
+		e.writeSeparator()
+		io.WriteString(e.w, rec.Content)
+		e.written++
+		return
+	}
+	if e.noHeader && rec.SameAs != "" {
+		return
+	}
+	if !e.writeSeparator() && e.noHeader && e.written > 0 {
+		io.WriteString(e.w, "\n")
+	}
+	if !e.noHeader {
+		fmt.Fprintln(e.w, headerLine(rec))
+	}
+	io.WriteString(e.w, rec.Content)
+	e.written++
+}
+
+// unescapeSeparator expands \n, \t, and \\ in a --file-separator, so a
+// separator with newlines can be given on the command line.
+func unescapeSeparator(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t").Replace(s)
+}
+
+// writeSeparator writes the --file-separator before every section but the
+// first, reporting whether it did.
+func (e *emitter) writeSeparator() bool {
+	if e.separator == "" || e.written == 0 {
+		return false
+	}
+	io.WriteString(e.w, e.separator)
+	return true
+}
+
+// note writes free-form plain-format text such as file trees and GitHub labels.
+// Templates fully control their output and jsonl must stay one record per
+// line, so notes are dropped there. Squashed files are held until finish, so
+// their notes are held with them and land in the index, next to the files
+// they describe.
+func (e *emitter) note(s string) {
+	if !e.plain() || e.raw {
+		return
+	}
+	if e.squash {
+		e.records = append(e.records, fileRecord{note: true, Content: s})
+		return
+	}
+	e.flushMerged()
+	io.WriteString(e.w, s)
+}
+
+func (e *emitter) finish() error {
+	emitProgress(progressDoneEvent{Event: "done", Files: e.progressFiles, Bytes: e.progressBytes})
+	if e.skip != nil {
+		infof("Deduped %d section(s) already in the clipboard\n", e.deduped)
+	}
+	if e.dedupe {
+		infof("Collapsed %d file(s) with duplicate content\n", e.collapsed)
+	}
+	if e.strip.redactStrings {
+		infof("Redacted %d string literal(s)\n", e.redacted)
+	}
+	if len(e.strip.markers) > 0 {
+		infof("Marked %d match(es) with --grep-mark\n", e.marked)
+	}
+	// The breakdown is a diagnostic like any other stderr output, so --quiet
+	// silences it.
+	if e.countFiles && !quietMode {
+		e.stats.reportFiles(os.Stderr)
+	}
+	if e.countReport {
+		e.stats.report(e.counter)
+	}
+	if e.price != nil {
+		e.stats.reportCost(*e.price, e.counter)
+	}
+	squashed := e.squash && e.plain()
+	if squashed {
+		e.noteDeleted()
+		e.writeSquashed()
+	}
+	e.flushMerged()
+	if e.jsonEncoded {
+		return e.writeJSON()
+	}
+	if e.tmpl == nil {
+		if !squashed {
+			e.noteDeleted()
+		}
+		e.writeSections()
+		return nil
+	}
+	if err := e.tmpl.Execute(e.w, e.records); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	return nil
+}
+
+// --fail-on-empty modes.
+const (
+	emptyContent = "content" // fail unless some file has content left
+	emptyMatched = "matched" // fail only when no file matched at all
+)
+
+// checkEmpty returns an error when --fail-on-empty applies to this pull.
+func (e *emitter) checkEmpty(mode string) error {
+	switch {
+	case mode == "":
+		return nil
+	case e.matched == 0 && e.nonEmpty == 0:
+		return fmt.Errorf("Error: no files matched (--fail-on-empty)")
+	case mode == emptyContent && e.nonEmpty == 0:
+		return fmt.Errorf("Error: %d file(s) matched but all were empty after stripping (--fail-on-empty)", e.matched)
+	}
+	return nil
+}
+
+// writeSections adds --prepend-tree and --append-summary around the files.
+func (e *emitter) writeSections() {
+	if !e.plain() {
+		return
+	}
+	if e.body != nil {
+		var sb strings.Builder
+		sb.WriteString("filetree:\n")
+		for _, p := range e.paths {
+			sb.WriteString(p + "\n")
+		}
+		io.WriteString(e.final, sb.String())
+		e.final.Write(e.body.Bytes())
+		e.w, e.body = e.final, nil
+	}
+	if e.appendSummary {
+		fmt.Fprintf(e.final, "summary: %s\n", e.stats.line(e.counter))
+	}
+}
+
+// noteDeleted ends an --only-new pull with a "deleted: <path>" line for each
+// file in the old manifest that is gone.
+func (e *emitter) noteDeleted() {
+	if e.changes == nil || e.changes.prev == nil {
+		return
+	}
+	for _, p := range e.changes.deleted() {
+		e.note("deleted: " + styledPath(p, e.pathStyle) + "\n")
+	}
+}
+
+// writeSquashed lists every file once under "files:", then writes the contents
+// back to back with a blank line between files. Notes are written into the
+// index where they were made. The blank line is the only
+// boundary, so squashing is refused with --strip-blank=false, which would let
+// content carry blank lines of its own. With --no-header the index is left out
+// too.
+func (e *emitter) writeSquashed() {
+	if len(e.records) == 0 {
+		return
+	}
+	if e.noHeader {
+		for _, rec := range e.records {
+			if rec.note {
+				io.WriteString(e.w, rec.Content)
+				continue
+			}
+			e.writeSection(rec)
+		}
+		return
+	}
+	io.WriteString(e.w, "files:\n")
+	for _, rec := range e.records {
+		if rec.note {
+			io.WriteString(e.w, rec.Content)
+			continue
+		}
+		if rec.SameAs != "" {
+			fmt.Fprintf(e.w, "%s (identical to %s)\n", rec.Path, rec.SameAs)
+			continue
+		}
+		io.WriteString(e.w, rec.Path+"\n")
+	}
+	written := 0
+	for _, rec := range e.records {
+		if rec.note || rec.SameAs != "" {
+			continue
+		}
+		if written > 0 && e.separator != "" {
+			io.WriteString(e.w, e.separator)
+		}
+		io.WriteString(e.w, "\n"+rec.Content)
+		written++
+	}
+}
+
+// jsonRecord is the shape of one --format jsonl line, and of each element of
+// the json format's array.
+type jsonRecord struct {
+	Path    string `json:"path"`
+	RelPath string `json:"rel_path"`
+	Size    int    `json:"size"`
+	Content string `json:"content"`
+	SameAs  string `json:"same_as,omitempty"`
+}
+
+// writeJSONLine writes rec as a single line of JSON. Encoding escapes the
+// newlines in the content, so every record stays on its own line.
+func (e *emitter) writeJSONLine(rec fileRecord) {
+	b, _ := json.Marshal(jsonRecord{Path: rec.Path, RelPath: rec.RelPath, Size: rec.Size, Content: rec.Content, SameAs: rec.SameAs})
+	e.w.Write(append(b, '\n'))
+}
+
+// writeJSON writes the json format with encoding/json instead of its
+// template: indented by jsonIndent spaces, or on one line when that is 0.
+func (e *emitter) writeJSON() error {
+	recs := make([]jsonRecord, len(e.records))
+	for i, rec := range e.records {
+		recs[i] = jsonRecord{Path: rec.Path, RelPath: rec.RelPath, Size: rec.Size, Content: rec.Content, SameAs: rec.SameAs}
+	}
+	var b []byte
+	var err error
+	if e.jsonIndent > 0 {
+		b, err = json.MarshalIndent(recs, "", strings.Repeat(" ", e.jsonIndent))
+	} else {
+		b, err = json.Marshal(recs)
+	}
+	if err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+func localRecord(p string, content string) fileRecord {
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		absPath = p
+	}
+	rel := p
+	if cwd, err := os.Getwd(); err == nil {
+		if r, err := filepath.Rel(cwd, absPath); err == nil {
+			rel = r
+		}
+	}
+	return fileRecord{
+		Path:    absPath,
+		RelPath: filepath.ToSlash(rel),
+		Content: content,
+		Ext:     normalizeExt(filepath.Ext(p)),
+		header:  "file",
+	}
+}
+
+// builtinTemplates back the --format values other than plain, which is written
+// directly so it can be produced incrementally.
+var builtinTemplates = map[string]string{
+	"md": `{{range .}}### {{.RelPath}}
+
+{{fence .Lang .Content}}
+
+{{end}}`,
+	"json": `[{{range $i, $f := .}}{{if $i}},{{end}}
+  {"path": {{json $f.Path}}, "rel_path": {{json $f.RelPath}}, "size": {{$f.Size}}, "content": {{json $f.Content}}{{if $f.SameAs}}, "same_as": {{json $f.SameAs}}{{end}}}{{end}}
+]
+`,
+	"xml": `<files>
+{{range .}}  <file path="{{xml .Path}}" rel_path="{{xml .RelPath}}" size="{{.Size}}">{{xml .Content}}</file>
+{{end}}</files>
+`,
+}
+
+var templateFuncs = template.FuncMap{
+	"fence":  fenceBlock,
+	"indent": indentLines,
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"json": func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b)
+	},
+	"xml":  xmlEscape,
+	"lang": fenceLanguage,
+}
+
+// loadOutputTemplate resolves --format and --template into a template. It
+// returns nil for the plain and jsonl formats, which the emitter writes itself.
+func loadOutputTemplate(format, templatePath string) (*template.Template, error) {
+	if templatePath != "" {
+		if err := checkSandbox(templatePath); err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("Error: reading template: %v", err)
+		}
+		t, err := template.New(filepath.Base(templatePath)).Funcs(templateFuncs).Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("Error: parsing template: %v", err)
+		}
+		return t, nil
+	}
+	if format == "" || format == "plain" || format == "jsonl" {
+		return nil, nil
+	}
+	src, ok := builtinTemplates[format]
+	if !ok {
+		return nil, fmt.Errorf("Error: Invalid value for --format: %q (expected plain, md, json, jsonl, or xml)", format)
+	}
+	return template.Must(template.New(format).Funcs(templateFuncs).Parse(src)), nil
+}
+
+// fenceBlock wraps content in a Markdown code fence long enough that backtick
+// runs inside the content can't close it early.
+func fenceBlock(lang string, content string) string {
+	ticks := 3
+	run := 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			if run >= ticks {
+				ticks = run + 1
+			}
+			continue
+		}
+		run = 0
+	}
+	fence := strings.Repeat("`", ticks)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fence + lang + "\n" + content + fence
+}
+
+func indentLines(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" && l != "\n" {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '&':
+			b.WriteString("&amp;")
+		case '"':
+			b.WriteString("&quot;")
+		case '\'':
+			b.WriteString("&apos;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSquashedNotesStayInIndex(t *testing.T) {
+	var buf bytes.Buffer
+	e := newEmitter(&buf, outputOptions{squash: true})
+	e.file(fileRecord{header: "file", Path: "a.go", Content: "package a\n"})
+	e.note("github: owner/repo\n")
+	e.file(fileRecord{header: "file", Path: "b.go", Content: "package b\n"})
+	if err := e.finish(); err != nil {
+		t.Fatal(err)
+	}
+	want := "files:\na.go\ngithub: owner/repo\nb.go\n\npackage a\n\npackage b\n"
+	if got := buf.String(); got != want {
+		t.Errorf("squashed output = %q, want %q", got, want)
+	}
+
+	parts := splitSections(want, func(s string) int { return len(s) }, 45)
+	wantParts := []string{
+		"files:\na.go\n\npackage a\n",
+		"files:\ngithub: owner/repo\nb.go\n\npackage b\n",
+	}
+	if len(parts) != len(wantParts) {
+		t.Fatalf("got parts %q, want %q", parts, wantParts)
+	}
+	for i := range wantParts {
+		if parts[i] != wantParts[i] {
+			t.Errorf("part %d = %q, want %q", i+1, parts[i], wantParts[i])
+		}
+	}
+}
+
+func TestStyledPath(t *testing.T) {
+	native := filepath.Join("a", "b", "c.go")
+	tests := []struct {
+		in    string
+		style string
+		want  string
+	}{
+		{native, pathPosix, "a/b/c.go"},
+		{native, pathWindows, `a\b\c.go`},
+		{native, pathNative, native},
+		{`a\b\c.go`, pathWindows, `a\b\c.go`},
+		{"/srv/app/main.go", pathWindows, `\srv\app\main.go`},
+	}
+	if filepath.Separator == '\\' {
+		tests = append(tests, struct{ in, style, want string }{`C:\src\a.go`, pathPosix, "C:/src/a.go"})
+	} else {
+		// On Unix a backslash is part of the name, so posix leaves it alone.
+		tests = append(tests, struct{ in, style, want string }{`a\b\c.go`, pathPosix, `a\b\c.go`})
+	}
+	for _, tt := range tests {
+		if got := styledPath(tt.in, tt.style); got != tt.want {
+			t.Errorf("styledPath(%q, %s) = %q, want %q", tt.in, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestWindowsPathsMatch(t *testing.T) {
+	if got := detectLanguage(`a\b\c.go`, ""); got != ".go" {
+		t.Errorf(`detectLanguage(a\b\c.go) = %q, want .go`, got)
+	}
+	if got, _ := basenameExt(`deploy\Dockerfile`); got != ".dockerfile" {
+		t.Errorf(`basenameExt(deploy\Dockerfile) = %q, want .dockerfile`, got)
+	}
+	for p, want := range map[string]bool{
+		`pkg\a_test.go`:        true,
+		`web\__tests__\app.js`: true,
+		`pkg\a.go`:             false,
+	} {
+		if got := isTestFile(p); got != want {
+			t.Errorf("isTestFile(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestHeaderPathStyle(t *testing.T) {
+	var buf bytes.Buffer
+	e := newEmitter(&buf, outputOptions{pathStyle: pathWindows})
+	e.file(fileRecord{header: "file", Path: filepath.Join("src", "main.go"), Content: "package main\n"})
+	if err := e.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "file: src\\main.go\npackage main\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFileSeparatorBetweenFilesOnly(t *testing.T) {
+	for _, squash := range []bool{false, true} {
+		var buf bytes.Buffer
+		e := newEmitter(&buf, outputOptions{separator: "---\n", squash: squash})
+		for _, name := range []string{"a.go", "b.go", "c.go"} {
+			e.file(fileRecord{header: "file", Path: name, Content: "package x\n"})
+		}
+		if err := e.finish(); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if n := strings.Count(out, "---\n"); n != 2 {
+			t.Errorf("squash=%v: %d separators in %q, want 2", squash, n, out)
+		}
+		if strings.HasPrefix(out, "---") || strings.HasSuffix(out, "---\n") {
+			t.Errorf("squash=%v: leading or trailing separator in %q", squash, out)
+		}
+	}
+}
+
+func TestHeaderOfSymlinkedFile(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	real := filepath.Join(dir, "real.go")
+	link := filepath.Join(dir, "link.go")
+	if err := os.WriteFile(real, []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	for _, resolve := range []bool{false, true} {
+		var buf bytes.Buffer
+		e := newEmitter(&buf, outputOptions{resolveLinks: resolve})
+		e.file(localRecord(link, "package a\n"))
+		if err := e.finish(); err != nil {
+			t.Fatal(err)
+		}
+		want := "file: " + filepath.ToSlash(link) + "\n"
+		if resolve {
+			want = "file: " + filepath.ToSlash(real) + "\n"
+		}
+		if !strings.HasPrefix(buf.String(), want) {
+			t.Errorf("resolveLinks=%v: output %q, want header %q", resolve, buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+// readPassword has no way to turn echo off here, so it refuses rather than
+// show the password on screen.
+func readPassword(prompt string) (string, error) {
+	return "", fmt.Errorf("can't prompt for a password on this platform; pass --user user:password")
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// readPassword prompts on stderr and reads a line from the terminal with echo
+// turned off through stty.
+func readPassword(prompt string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("no terminal to prompt for a password")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	if err := stty("-echo"); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	stty("echo")
+	fmt.Fprintln(os.Stderr)
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultInputPrices is the built-in table for --estimate-cost: US dollars
+// per million input tokens, from the providers' published list prices.
+// Prices change more often than pull does, so prices.json in the config
+// directory can override or extend it.
+var defaultInputPrices = map[string]float64{
+	"gpt-4o":            2.50,
+	"gpt-4o-mini":       0.15,
+	"gpt-4.1":           2.00,
+	"gpt-4.1-mini":      0.40,
+	"gpt-4.1-nano":      0.10,
+	"gpt-4-turbo":       10.00,
+	"gpt-4":             30.00,
+	"gpt-3.5-turbo":     0.50,
+	"o1":                15.00,
+	"o3":                2.00,
+	"o3-mini":           1.10,
+	"o4-mini":           1.10,
+	"claude-opus-4":     15.00,
+	"claude-sonnet-4":   3.00,
+	"claude-3-7-sonnet": 3.00,
+	"claude-3-5-sonnet": 3.00,
+	"claude-3-5-haiku":  0.80,
+	"gemini-2.5-pro":    1.25,
+	"gemini-2.5-flash":  0.30,
+}
+
+// modelPrice is the input price --estimate-cost charges for a model.
+type modelPrice struct {
+	model   string  // the table entry that matched
+	perMTok float64 // dollars per million input tokens
+}
+
+// configDir is where pull reads user settings: $XDG_CONFIG_HOME/pull, or the
+// OS's usual config directory.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Error: no config directory: %v", err)
+	}
+	return filepath.Join(dir, "pull"), nil
+}
+
+// inputPrices returns the built-in table with prices.json from the config
+// directory merged over it. The file is a JSON object of model name to
+// dollars per million input tokens; a missing file is not an error.
+func inputPrices() (map[string]float64, error) {
+	prices := make(map[string]float64, len(defaultInputPrices))
+	for m, p := range defaultInputPrices {
+		prices[m] = p
+	}
+	dir, err := configDir()
+	if err != nil {
+		return prices, nil
+	}
+	path := filepath.Join(dir, "prices.json")
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return prices, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error: %v", err)
+	}
+	var overrides map[string]float64
+	if err := json.Unmarshal(b, &overrides); err != nil {
+		return nil, fmt.Errorf("Error: %s: %v", path, err)
+	}
+	for m, p := range overrides {
+		if p < 0 {
+			return nil, fmt.Errorf("Error: %s: negative price for %q", path, m)
+		}
+		prices[strings.ToLower(m)] = p
+	}
+	return prices, nil
+}
+
+// lookupPrice finds model's input price. Dated or suffixed names such as
+// gpt-4o-2024-08-06 match the longest table entry they start with.
+func lookupPrice(model string) (modelPrice, error) {
+	prices, err := inputPrices()
+	if err != nil {
+		return modelPrice{}, err
+	}
+	name := strings.ToLower(model)
+	if p, ok := prices[name]; ok {
+		return modelPrice{model: name, perMTok: p}, nil
+	}
+	best := ""
+	for m := range prices {
+		if strings.HasPrefix(name, m+"-") && len(m) > len(best) {
+			best = m
+		}
+	}
+	if best != "" {
+		return modelPrice{model: best, perMTok: prices[best]}, nil
+	}
+	known := make([]string, 0, len(prices))
+	for m := range prices {
+		known = append(known, m)
+	}
+	sort.Strings(known)
+	where := "prices.json in the config directory"
+	if dir, err := configDir(); err == nil {
+		where = filepath.Join(dir, "prices.json")
+	}
+	return modelPrice{}, fmt.Errorf("Error: no price for model %q (known: %s); add it to %s", model, strings.Join(known, ", "), where)
+}
+
+// reportCost prints the --estimate-cost line for the pull's token total.
+func (s *pullStats) reportCost(p modelPrice, c *tokenCounter) {
+	cost := float64(s.tokens) * p.perMTok / 1e6
+	fmt.Fprintf(os.Stderr, "Estimated cost: $%.4f for %d %s at $%.2f/1M input tokens (%s)\n", cost, s.tokens, c.label(), p.perMTok, p.model)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// stopProfiles finishes any --profile/--memprofile output. fatal and exit call
+// it too, so a run that fails part way still leaves a usable profile behind.
+var stopProfiles = func() {}
+
+// exit ends the process with code. os.Exit skips deferred calls, so the
+// profiles are finished here first.
+func exit(code int) {
+	stopProfiles()
+	os.Exit(code)
+}
+
+// startProfiles starts a CPU profile into cpuPath and arranges for a heap
+// profile to be written to memPath when the run ends. Either may be empty.
+func startProfiles(cpuPath string, memPath string) error {
+	var cpu *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return fmt.Errorf("Error: --profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("Error: --profile: %v", err)
+		}
+		cpu = f
+	}
+	stopProfiles = func() {
+		stopProfiles = func() {}
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if memPath != "" {
+			writeHeapProfile(memPath)
+		}
+	}
+	return nil
+}
+
+func writeHeapProfile(p string) {
+	f, err := os.Create(p)
+	if err != nil {
+		warnf("Warning: --memprofile: %v\n", err)
+		return
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		warnf("Warning: --memprofile: %v\n", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// progressJSON streams one JSON progress event per line to stderr
+// (--progress-json), for tools that wrap pull.
+var progressJSON bool
+
+// progressFileEvent is sent as each file or page is added to the output.
+type progressFileEvent struct {
+	Event string `json:"event"` // "file"
+	Path  string `json:"path"`
+	Bytes int    `json:"bytes"`
+}
+
+// progressDoneEvent is sent once every file is in, before the output is
+// delivered.
+type progressDoneEvent struct {
+	Event string `json:"event"` // "done"
+	Files int    `json:"files"`
+	Bytes int    `json:"bytes"`
+}
+
+// emitProgress writes ev as one line. Progress was asked for explicitly, so
+// --quiet doesn't silence it.
+func emitProgress(ev any) {
+	if !progressJSON {
+		return
+	}
+	b, _ := json.Marshal(ev)
+	fmt.Fprintln(os.Stderr, string(b))
+}
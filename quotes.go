@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// straightQuotes maps typographic quotes to the ASCII quote they stand for
+// (--normalize-quotes). Guillemets and primes are left alone: they are real
+// punctuation, not word-processor artifacts.
+var straightQuotes = map[rune]byte{
+	'\u2018': '\'', '\u2019': '\'', '\u201a': '\'', '\u201b': '\'',
+	'\u201c': '"', '\u201d': '"', '\u201e': '"', '\u201f': '"',
+}
+
+// quoteSink decorates a sink with --normalize-quotes. Like asciiSink, it
+// holds back a multibyte rune split across writes until the rest arrives.
+type quoteSink struct {
+	sink
+	carry    []byte
+	replaced int
+}
+
+func (s *quoteSink) Write(p []byte) (int, error) {
+	buf := append(s.carry, p...)
+	s.carry = nil
+	var out strings.Builder
+	out.Grow(len(buf))
+	for len(buf) > 0 {
+		r, size := utf8.DecodeRune(buf)
+		if r == utf8.RuneError && size <= 1 && !utf8.FullRune(buf) {
+			s.carry = append([]byte(nil), buf...)
+			break
+		}
+		if q, ok := straightQuotes[r]; ok {
+			out.WriteByte(q)
+			s.replaced++
+		} else {
+			out.Write(buf[:size])
+		}
+		buf = buf[size:]
+	}
+	if _, err := s.sink.Write([]byte(out.String())); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *quoteSink) Close() error {
+	if len(s.carry) > 0 {
+		s.sink.Write(s.carry)
+		s.carry = nil
+	}
+	if s.replaced > 0 {
+		infof("Straightened %d typographic quote(s)\n", s.replaced)
+	}
+	return s.sink.Close()
+}
@@ -0,0 +1,145 @@
+package main
+
+import "strings"
+
+// stringQuote is one way a language writes string literals, for
+// --redact-strings.
+type stringQuote struct {
+	delim     string // opens and closes the literal
+	multiline bool   // the literal may span lines
+	escapes   bool   // a backslash escapes the next character
+}
+
+var (
+	doubleQuoted = stringQuote{delim: `"`, escapes: true}
+	singleQuoted = stringQuote{delim: `'`, escapes: true}
+	backtickRaw  = stringQuote{delim: "`", multiline: true}
+	backtickTmpl = stringQuote{delim: "`", multiline: true, escapes: true}
+	tripleDouble = stringQuote{delim: `"""`, multiline: true, escapes: true}
+	tripleSingle = stringQuote{delim: `'''`, multiline: true, escapes: true}
+)
+
+// stringQuotes lists each language's literals, longest delimiter first.
+// Languages not listed use defaultStringQuotes.
+var stringQuotes = map[string][]stringQuote{
+	".go":    {doubleQuoted, backtickRaw},
+	".js":    {doubleQuoted, singleQuoted, backtickTmpl},
+	".jsx":   {doubleQuoted, singleQuoted, backtickTmpl},
+	".mjs":   {doubleQuoted, singleQuoted, backtickTmpl},
+	".cjs":   {doubleQuoted, singleQuoted, backtickTmpl},
+	".ts":    {doubleQuoted, singleQuoted, backtickTmpl},
+	".tsx":   {doubleQuoted, singleQuoted, backtickTmpl},
+	".py":    {tripleDouble, tripleSingle, doubleQuoted, singleQuoted},
+	".rs":    {doubleQuoted},
+	".c":     {doubleQuoted},
+	".h":     {doubleQuoted},
+	".cpp":   {doubleQuoted},
+	".hpp":   {doubleQuoted},
+	".cs":    {doubleQuoted},
+	".java":  {tripleDouble, doubleQuoted},
+	".kt":    {tripleDouble, doubleQuoted},
+	".swift": {tripleDouble, doubleQuoted},
+	".scala": {tripleDouble, doubleQuoted},
+}
+
+var defaultStringQuotes = []stringQuote{doubleQuoted, singleQuoted}
+
+// charLiteralExts are languages where '...' is a character (or, in Rust, a
+// lifetime), not a string. Short quoted characters are passed over so a
+// quote inside one, as in '"', doesn't open a string.
+var charLiteralExts = map[string]bool{
+	".go": true, ".rs": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true,
+	".cs": true, ".java": true, ".kt": true, ".scala": true,
+}
+
+// redactPlaceholder replaces the contents of every redacted literal.
+const redactPlaceholder = "..."
+
+// redactStrings replaces the contents of the string literals in content with
+// redactPlaceholder, keeping the quotes (--redact-strings), and returns how
+// many it replaced. It is a scanner, not a parser: a quote inside a comment
+// can start a literal, which is why single-line literals that don't close on
+// their line are left alone. Interpolations such as ${x} are redacted along
+// with the rest of the literal.
+func redactStrings(content string, ext string) (string, int) {
+	quotes, ok := stringQuotes[ext]
+	if !ok {
+		quotes = defaultStringQuotes
+	}
+	var sb strings.Builder
+	count := 0
+	for i := 0; i < len(content); {
+		if content[i] == '\'' && charLiteralExts[ext] {
+			if n := charLiteralLen(content[i:]); n > 0 {
+				sb.WriteString(content[i : i+n])
+				i += n
+				continue
+			}
+		}
+		q, ok := quoteAt(content[i:], quotes)
+		if !ok {
+			sb.WriteByte(content[i])
+			i++
+			continue
+		}
+		end := literalEnd(content[i+len(q.delim):], q)
+		if end < 0 {
+			// Unterminated on its line: most likely not a literal at all.
+			sb.WriteString(q.delim)
+			i += len(q.delim)
+			continue
+		}
+		sb.WriteString(q.delim)
+		if end > 0 {
+			sb.WriteString(redactPlaceholder)
+			count++
+		}
+		sb.WriteString(q.delim)
+		i += 2*len(q.delim) + end
+	}
+	return sb.String(), count
+}
+
+func quoteAt(s string, quotes []stringQuote) (stringQuote, bool) {
+	for _, q := range quotes {
+		if strings.HasPrefix(s, q.delim) {
+			return q, true
+		}
+	}
+	return stringQuote{}, false
+}
+
+// literalEnd returns the length of a literal's body in s (which starts just
+// after the opening delimiter), or -1 when it doesn't close.
+func literalEnd(s string, q stringQuote) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case q.escapes && s[i] == '\\':
+			i++
+		case s[i] == '\n' && !q.multiline:
+			return -1
+		case strings.HasPrefix(s[i:], q.delim):
+			return i
+		}
+	}
+	return -1
+}
+
+// charLiteralLen returns the length of a character literal such as 'a' or
+// '\n' at the start of s, or 0 when there isn't one.
+func charLiteralLen(s string) int {
+	for i := 1; i < len(s) && i < 12; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			return 0
+		case '\'':
+			if i == 1 {
+				return 0
+			}
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// registerName is what --register accepts: a plain file name, so a register
+// can never point outside the registers directory.
+var registerName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// registerPath returns the file backing a named register (--register), under
+// the state directory.
+func registerPath(name string) (string, error) {
+	if !registerName.MatchString(name) {
+		return "", fmt.Errorf("Error: Invalid value for --register: %q (use letters, digits, '.', '_', and '-')", name)
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "registers", name), nil
+}
+
+// readRegister returns a register's content; a register never written to is
+// empty.
+func readRegister(name string) (string, error) {
+	p, err := registerPath(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("Error reading register %s: %v", name, err)
+	}
+	return string(b), nil
+}
+
+// readSource reads the clipboard, or the named register when there is one.
+func readSource(register string) (string, error) {
+	if register != "" {
+		return readRegister(register)
+	}
+	content, err := readClipboard()
+	if err != nil {
+		return "", fmt.Errorf("Error reading clipboard: %v", err)
+	}
+	return content, nil
+}
+
+// clearRegister removes a register.
+func clearRegister(name string) error {
+	p, err := registerPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Error clearing register %s: %v", name, err)
+	}
+	return nil
+}
+
+// registerSink stands in for the clipboard with --register. Like the
+// clipboard it is written in one go on Close, so a failed pull leaves the
+// register as it was.
+type registerSink struct {
+	buf  strings.Builder
+	name string
+	path string
+}
+
+func newRegisterSink(name string) (*registerSink, error) {
+	p, err := registerPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return &registerSink{name: name, path: p}, nil
+}
+
+func (s *registerSink) Write(p []byte) (int, error) { return s.buf.Write(p) }
+
+func (s *registerSink) Close() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("Error creating directory: %v", err)
+	}
+	if err := writeFileAtomic(s.path, []byte(s.buf.String()), 0600); err != nil {
+		return fmt.Errorf("Error writing register %s: %v", s.name, err)
+	}
+	return nil
+}
+
+func (s *registerSink) doneMessage() string {
+	return fmt.Sprintf("Saved to register %s!", s.name)
+}
+
+// listRegisters prints every register with its size, by name (the registers
+// command).
+func listRegisters(w io.Writer) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "registers"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Error reading registers: %v", err)
+	}
+	var names []string
+	sizes := make(map[string]int64)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || !registerName.MatchString(e.Name()) {
+			continue
+		}
+		names = append(names, e.Name())
+		sizes[e.Name()] = info.Size()
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No registers.")
+		return nil
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%d bytes\n", name, sizes[name])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reindentOptions configure --reindent: every leading indentation level is
+// rewritten as one tab or as size spaces.
+type reindentOptions struct {
+	tabs bool
+	size int // spaces per level when !tabs
+
+	editorconfig *editorConfigs // non-nil with --respect-editorconfig
+}
+
+// parseReindent parses "spaces", "spaces=N", or "tabs".
+func parseReindent(v string) (*reindentOptions, error) {
+	style, n, hasN := strings.Cut(strings.ToLower(strings.TrimSpace(v)), "=")
+	switch style {
+	case "tabs":
+		if hasN {
+			break
+		}
+		return &reindentOptions{tabs: true}, nil
+	case "spaces":
+		size := 4
+		if hasN {
+			var err error
+			size, err = strconv.Atoi(n)
+			if err != nil || size < 1 {
+				break
+			}
+		}
+		return &reindentOptions{size: size}, nil
+	}
+	return nil, fmt.Errorf("Error: Invalid value for --reindent: %q (expected spaces, spaces=N, or tabs)", v)
+}
+
+// sourceIndent is how a file was indented: unit columns per level, with tabs
+// advancing to the next multiple of tabWidth.
+type sourceIndent struct {
+	unit     int
+	tabWidth int
+}
+
+// indentFor works out how p is indented, from .editorconfig when enabled and
+// from the content otherwise. Without .editorconfig the smallest space-only
+// indentation is taken as one level.
+func (o *reindentOptions) indentFor(p string, content string) sourceIndent {
+	si := sourceIndent{tabWidth: 4}
+	if o.editorconfig != nil {
+		props := o.editorconfig.properties(p)
+		size, _ := strconv.Atoi(props["indent_size"])
+		if tw, err := strconv.Atoi(props["tab_width"]); err == nil && tw > 0 {
+			si.tabWidth = tw
+		} else if size > 0 {
+			si.tabWidth = size
+		}
+		switch {
+		case size > 0:
+			si.unit = size
+		case props["indent_style"] == "tab" || props["indent_size"] == "tab":
+			si.unit = si.tabWidth
+		}
+	}
+	if si.unit == 0 {
+		si.unit = smallestSpaceIndent(content)
+	}
+	if si.unit == 0 {
+		si.unit = si.tabWidth
+	}
+	return si
+}
+
+func smallestSpaceIndent(content string) int {
+	best := 0
+	for _, line := range strings.Split(content, "\n") {
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if n == 0 || n == len(line) || line[n] == '\t' {
+			continue
+		}
+		if best == 0 || n < best {
+			best = n
+		}
+	}
+	if best > 8 {
+		return 0
+	}
+	return best
+}
+
+// reindent rewrites the leading whitespace of every line of content. Columns
+// left over after whole levels (alignment) are kept as spaces.
+func (o *reindentOptions) reindent(p string, content string) string {
+	si := o.indentFor(p, content)
+	lines := strings.SplitAfter(content, "\n")
+	for i, line := range lines {
+		body := strings.TrimLeft(line, " \t")
+		lead := line[:len(line)-len(body)]
+		if lead == "" || body == "" || body == "\n" {
+			continue
+		}
+		col := 0
+		for _, c := range lead {
+			if c == '\t' {
+				col += si.tabWidth - col%si.tabWidth
+				continue
+			}
+			col++
+		}
+		levels, rest := col/si.unit, col%si.unit
+		per := strings.Repeat(" ", o.size)
+		if o.tabs {
+			per = "\t"
+		}
+		lines[i] = strings.Repeat(per, levels) + strings.Repeat(" ", rest) + body
+	}
+	return strings.Join(lines, "")
+}
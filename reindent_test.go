@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestDedent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"tabs with a blank line", "\t\tfoo\n\n\t\tbar\n", "foo\n\nbar\n"},
+		{"shared tab then spaces", "\t  a\n\t    b\n", "a\n  b\n"},
+		{"tab against spaces", "\ta\n    b\n", "\ta\n    b\n"},
+		{"whitespace-only line", "    a\n  \n    b\n", "a\n  \nb\n"},
+		{"nothing shared", "a\n  b\n", "a\n  b\n"},
+		{"no trailing newline", "  a\n  b", "a\nb"},
+	}
+	for _, tt := range tests {
+		if got := dedent(tt.in); got != tt.want {
+			t.Errorf("%s: dedent(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
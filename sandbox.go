@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sandboxRoot confines the files pull reads and writes for the user
+// (--sandbox-root); "" means no sandbox. It is absolute with symlinks
+// resolved, so checks compare real locations. pull's own state and config,
+// and the ignore, attributes, and .editorconfig files it finds on its way up
+// to a repository root, are not restricted: they never end up in the output.
+var sandboxRoot string
+
+// errOutsideSandbox is how a file skipped by the sandbox is reported in a
+// walk, where the path is already part of the warning.
+var errOutsideSandbox = errors.New("outside the sandbox root")
+
+func setSandboxRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("Error: --sandbox-root: %v", err)
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return fmt.Errorf("Error: --sandbox-root: %v", err)
+	}
+	if st, err := os.Stat(real); err != nil || !st.IsDir() {
+		return fmt.Errorf("Error: --sandbox-root: %s is not a directory", dir)
+	}
+	sandboxRoot = real
+	return nil
+}
+
+// checkSandbox returns an error naming p when it lies outside sandboxRoot.
+// p is made absolute first, so ".." can't climb out, and its symlinks are
+// resolved, so neither can a link. p doesn't have to exist yet: files about
+// to be written are checked by where they would be created.
+func checkSandbox(p string) error {
+	if sandboxRoot == "" {
+		return nil
+	}
+	real, err := realPath(p)
+	if err != nil {
+		return fmt.Errorf("Error: --sandbox-root: %v", err)
+	}
+	if !isWithin(sandboxRoot, real) {
+		return fmt.Errorf("Error: %s is outside the sandbox root %s", p, sandboxRoot)
+	}
+	return nil
+}
+
+// realPath resolves the symlinks in the longest existing prefix of p and
+// appends the rest unchanged.
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := abs; ; {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
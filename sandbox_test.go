@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSandboxKeepsOuterGitIgnore(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	sub := filepath.Join(root, "sub")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("secret.txt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(sub, "secret.txt")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setSandboxRoot(sub); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { sandboxRoot = "" }()
+
+	for _, global := range []bool{false, true} {
+		f := (&localFilter{globalExcludes: global}).forStart(sub)
+		if !f.ignored(secret) {
+			t.Errorf("globalExcludes=%v: %s not ignored under --sandbox-root", global, secret)
+		}
+	}
+}
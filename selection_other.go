@@ -0,0 +1,17 @@
+//go:build !(freebsd || linux || netbsd || openbsd || solaris || dragonfly)
+
+package main
+
+import "errors"
+
+// setSelection only supports the regular clipboard outside of X11 systems.
+func setSelection(name string) error {
+	switch name {
+	case "", "clipboard":
+		return nil
+	case "primary":
+		return errors.New("Error: --selection primary is only supported on Linux/BSD")
+	default:
+		return errUnknownSelection(name)
+	}
+}
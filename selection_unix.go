@@ -0,0 +1,18 @@
+//go:build freebsd || linux || netbsd || openbsd || solaris || dragonfly
+
+package main
+
+import "github.com/atotto/clipboard"
+
+// setSelection picks the X11 selection the clipboard backend talks to.
+func setSelection(name string) error {
+	switch name {
+	case "", "clipboard":
+		clipboard.Primary = false
+	case "primary":
+		clipboard.Primary = true
+	default:
+		return errUnknownSelection(name)
+	}
+	return nil
+}
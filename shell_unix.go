@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "os/exec"
+
+// shellCommand runs command with sh, for the --pre-walk and --post-write
+// hooks.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
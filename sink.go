@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sink is where a pull's output goes. Content is written as it is produced;
+// Close completes delivery.
+type sink interface {
+	io.Writer
+	Close() error
+	doneMessage() string // status line printed after a successful Close
+}
+
+// destination selects the sink: the clipboard (default), stdout (--stdout), a
+// file (--out), a named register (--register), a content hash (the hash
+// command), numbered parts (--split-by-size/--split-by-tokens), or nowhere
+// (--count-only).
+type destination struct {
+	discard  bool
+	stdout   bool
+	register string // named register instead of the clipboard (--register)
+	file     string
+	hash     bool
+	split    *splitOptions
+
+	clipType       string // MIME type for the clipboard (--clip-type)
+	retryClipboard bool   // retry a failed clipboard write, then save to a file (--retry-clipboard)
+	warnSize       int64  // confirm clipboard writes over this size (--warn-size)
+
+	// Transforms of the new content, applied in this order before it is
+	// merged with existing content: --summarize, --normalize-unicode,
+	// --normalize-quotes, then --ascii-only.
+	summary   *summaryOptions
+	normalize string
+	quotes    bool
+	asciiMode string
+}
+
+// openSink builds the sink for dest, wrapped with the content transforms that
+// were requested. Existing content being appended to is never transformed.
+func openSink(dest destination, modes clipboardModes) (sink, string, error) {
+	if dest.discard {
+		return discardSink{}, "", nil
+	}
+	s, existing, err := openBaseSink(dest, modes)
+	if err != nil {
+		return nil, "", err
+	}
+	if dest.asciiMode != "" {
+		s = newASCIISink(s, dest.asciiMode)
+	}
+	if dest.quotes {
+		s = &quoteSink{sink: s}
+	}
+	if form, ok := normalizationForms[dest.normalize]; ok {
+		s = newNormSink(s, form)
+	}
+	if dest.summary != nil {
+		s = &summarySink{sink: s, opts: *dest.summary}
+	}
+	return s, existing, nil
+}
+
+// openBaseSink builds the sink for dest. When --append or --prepend is set, the
+// destination's current content is read first and the sink is wrapped so new
+// content lands after or before it. The existing content is returned as well.
+// Stdout has no existing content, so the modes are a no-op there.
+func openBaseSink(dest destination, modes clipboardModes) (sink, string, error) {
+	merge := modes.appendMode || modes.prependMode
+
+	var existing string
+	var base sink
+	switch {
+	case dest.hash:
+		return &hashSink{h: newContentHash()}, "", nil
+
+	case dest.split != nil:
+		return &splitSink{opts: *dest.split}, "", nil
+
+	case dest.stdout:
+		return stdoutSink{}, "", nil
+
+	case dest.file != "":
+		if merge {
+			b, _ := os.ReadFile(dest.file)
+			existing = string(b)
+		}
+		fs, err := newFileSink(dest.file)
+		if err != nil {
+			return nil, "", err
+		}
+		base = fs
+
+	case dest.register != "":
+		if merge {
+			c, err := readRegister(dest.register)
+			if err != nil {
+				return nil, "", err
+			}
+			existing = c
+		}
+		rs, err := newRegisterSink(dest.register)
+		if err != nil {
+			return nil, "", err
+		}
+		base = rs
+
+	default:
+		if merge {
+			flag := "--append"
+			if !modes.appendMode {
+				flag = "--prepend"
+			}
+			c, err := modes.readExisting(flag)
+			if err != nil {
+				return nil, "", err
+			}
+			existing = c
+		}
+		base = &clipboardSink{mime: dest.clipType, retry: dest.retryClipboard, warnSize: dest.warnSize}
+	}
+
+	if !merge {
+		return base, "", nil
+	}
+	return newMergeSink(base, existing, modes), existing, nil
+}
+
+// stdoutSink streams straight to stdout.
+type stdoutSink struct{}
+
+func (stdoutSink) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdoutSink) Close() error                { return nil }
+func (stdoutSink) doneMessage() string         { return "" }
+
+// discardSink drops everything; --count-only only wants the stats.
+type discardSink struct{}
+
+func (discardSink) Write(p []byte) (int, error) { return len(p), nil }
+func (discardSink) Close() error                { return nil }
+func (discardSink) doneMessage() string         { return "" }
+
+// hashSink digests the output instead of storing it (with --hash-algo); the
+// hex digest is the status line.
+type hashSink struct {
+	h hash.Hash
+}
+
+func (s *hashSink) Write(p []byte) (int, error) { return s.h.Write(p) }
+func (s *hashSink) Close() error                { return nil }
+func (s *hashSink) doneMessage() string         { return hex.EncodeToString(s.h.Sum(nil)) }
+
+// fileSink streams to a file, creating parent directories as needed.
+type fileSink struct {
+	f    *os.File
+	path string
+}
+
+func newFileSink(target string) (*fileSink, error) {
+	if err := checkSandbox(target); err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(target); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("Error creating directory: %v", err)
+		}
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Error writing file: %v", err)
+	}
+	return &fileSink{f: f, path: target}, nil
+}
+
+func (s *fileSink) Write(p []byte) (int, error) { return s.f.Write(p) }
+
+func (s *fileSink) Close() error {
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("Error writing file: %v", err)
+	}
+	return nil
+}
+
+func (s *fileSink) doneMessage() string { return fmt.Sprintf("Written to %s", s.path) }
+
+// clipboardRetries is how many more times --retry-clipboard tries a failed
+// clipboard write before saving the content to a file.
+const clipboardRetries = 2
+
+// clipboardSink buffers everything, since the clipboard takes a single string,
+// and writes it on Close. With a MIME type it tries a typed backend first and
+// falls back to plain text. With retry, a failed write is retried and the
+// content is finally saved to a temporary file, so the pull isn't lost.
+type clipboardSink struct {
+	buf      strings.Builder
+	mime     string
+	retry    bool
+	warnSize int64  // ask before copying more than this many bytes (--warn-size); 0 = never
+	savedTo  string // the fallback file, when the clipboard never took it
+}
+
+func (s *clipboardSink) Write(p []byte) (int, error) { return s.buf.Write(p) }
+
+func (s *clipboardSink) Close() error {
+	// Only ask when someone can answer; scripts and pipes copy as before.
+	if s.warnSize > 0 && int64(s.buf.Len()) > s.warnSize && isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		q := fmt.Sprintf("About to copy %d bytes to the clipboard (over --warn-size %d). Continue?", s.buf.Len(), s.warnSize)
+		if !confirmOn(os.Stderr, q) {
+			return fmt.Errorf("Aborted: the clipboard was left as it was")
+		}
+	}
+	err := s.write()
+	if err == nil || !s.retry {
+		return err
+	}
+	// A backend that timed out would most likely hang again.
+	var timedOut errClipboardTimeout
+	for attempt := 1; attempt <= clipboardRetries && !errors.As(err, &timedOut); attempt++ {
+		warnf("Warning: %v; retrying (%d/%d)\n", err, attempt, clipboardRetries)
+		time.Sleep(time.Duration(attempt) * 250 * time.Millisecond)
+		if err = s.write(); err == nil {
+			return nil
+		}
+	}
+	var f *os.File
+	ferr := checkSandbox(os.TempDir())
+	if ferr == nil {
+		f, ferr = os.CreateTemp("", "pull-*.txt")
+	}
+	if ferr == nil {
+		_, ferr = f.WriteString(s.buf.String())
+		if cerr := f.Close(); ferr == nil {
+			ferr = cerr
+		}
+	}
+	if ferr != nil {
+		return fmt.Errorf("%v (saving to a file failed too: %v)", err, ferr)
+	}
+	warnf("Warning: %v\n", err)
+	s.savedTo = f.Name()
+	return nil
+}
+
+func (s *clipboardSink) write() error {
+	if s.mime != "" {
+		var ok bool
+		write := typedClipboardWrite
+		err := withClipboardTimeout(func() error {
+			var err error
+			ok, err = write(s.buf.String(), s.mime)
+			return err
+		})
+		if _, timedOut := err.(errClipboardTimeout); timedOut {
+			return fmt.Errorf("Error writing to clipboard: %w", err)
+		}
+		if ok {
+			if err != nil {
+				return fmt.Errorf("Error writing to clipboard: %w", err)
+			}
+			return nil
+		}
+		warnf("Warning: the clipboard backend doesn't support --clip-type; copying as plain text\n")
+	}
+	if err := writeClipboard(s.buf.String()); err != nil {
+		return fmt.Errorf("Error writing to clipboard: %w", err)
+	}
+	return nil
+}
+
+func (s *clipboardSink) doneMessage() string {
+	if s.savedTo != "" {
+		return fmt.Sprintf("Clipboard unavailable; saved to %s", s.savedTo)
+	}
+	return "Copied to clipboard!"
+}
+
+// mergeSink decorates a sink with --append/--prepend: existing content is
+// written before the new content (append) or after it (prepend), with a
+// newline between the two when needed.
+type mergeSink struct {
+	sink
+	existing string
+	prepend  bool
+	wrote    bool
+	last     byte
+}
+
+func newMergeSink(inner sink, existing string, modes clipboardModes) *mergeSink {
+	m := &mergeSink{sink: inner}
+	if modes.appendMode {
+		if existing != "" {
+			io.WriteString(inner, existing)
+			if !strings.HasSuffix(existing, "\n") {
+				io.WriteString(inner, "\n")
+			}
+		}
+		return m
+	}
+	m.existing = existing
+	m.prepend = true
+	return m
+}
+
+func (m *mergeSink) Write(p []byte) (int, error) {
+	n, err := m.sink.Write(p)
+	if n > 0 {
+		m.wrote = true
+		m.last = p[n-1]
+	}
+	return n, err
+}
+
+func (m *mergeSink) Close() error {
+	if m.prepend && m.existing != "" {
+		if m.wrote && m.last != '\n' {
+			io.WriteString(m.sink, "\n")
+		}
+		io.WriteString(m.sink, m.existing)
+	}
+	return m.sink.Close()
+}
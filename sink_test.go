@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSinks(t *testing.T) {
+	const content = "file: a.go\npackage a\n"
+	sum := sha256.Sum256([]byte(content))
+
+	tests := []struct {
+		name string
+		open func(t *testing.T) (sink, func() string) // the sink, and what it delivered
+		want string
+	}{
+		{"stdout", func(t *testing.T) (sink, func() string) {
+			return stdoutSink{}, captureStdout(t)
+		}, content},
+		{"file", func(t *testing.T) (sink, func() string) {
+			p := filepath.Join(t.TempDir(), "sub", "out.txt")
+			s, err := newFileSink(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s, readFileFunc(t, p)
+		}, content},
+		{"append", func(t *testing.T) (sink, func() string) {
+			p := filepath.Join(t.TempDir(), "out.txt")
+			s, err := newFileSink(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return newMergeSink(s, "old", clipboardModes{appendMode: true}), readFileFunc(t, p)
+		}, "old\n" + content},
+		{"prepend", func(t *testing.T) (sink, func() string) {
+			p := filepath.Join(t.TempDir(), "out.txt")
+			s, err := newFileSink(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return newMergeSink(s, "old\n", clipboardModes{prependMode: true}), readFileFunc(t, p)
+		}, content + "old\n"},
+		{"hash", func(t *testing.T) (sink, func() string) {
+			s := &hashSink{h: sha256.New()}
+			return s, s.doneMessage
+		}, hex.EncodeToString(sum[:])},
+		{"clipboard", func(t *testing.T) (sink, func() string) {
+			var copied string
+			fakeClipboard(t, nil, func(s string) error {
+				copied = s
+				return nil
+			})
+			return &clipboardSink{}, func() string { return copied }
+		}, content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, delivered := tt.open(t)
+			if _, err := io.WriteString(s, content); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := delivered(); got != tt.want {
+				t.Errorf("delivered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// captureStdout redirects os.Stdout until the returned func is called, which
+// returns everything written to it.
+func captureStdout(t *testing.T) func() string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = old })
+	return func() string {
+		w.Close()
+		os.Stdout = old
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+}
+
+func readFileFunc(t *testing.T, p string) func() string {
+	return func() string {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+}
+
+func TestClipboardSinkRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int // writes that fail before one succeeds
+		wantCalls int
+		wantSaved bool
+	}{
+		{"first try", 0, 1, false},
+		{"after a retry", 1, 2, false},
+		{"saved to a file", 10, 1 + clipboardRetries, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			fakeClipboard(t, nil, func(string) error {
+				calls++
+				if calls <= tt.failures {
+					return errors.New("no display")
+				}
+				return nil
+			})
+			s := &clipboardSink{retry: true}
+			s.Write([]byte("hello\n"))
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("backend called %d times, want %d", calls, tt.wantCalls)
+			}
+			if (s.savedTo != "") != tt.wantSaved {
+				t.Fatalf("savedTo = %q, want saved=%v", s.savedTo, tt.wantSaved)
+			}
+			if tt.wantSaved {
+				if b, _ := os.ReadFile(s.savedTo); string(b) != "hello\n" {
+					t.Errorf("saved file holds %q", b)
+				}
+			}
+		})
+	}
+}
+
+// fakeClipboard replaces the clipboard backends for the length of a test.
+// typed and plain stand in for the typed and plain-text backends.
+func fakeClipboard(t *testing.T, typed func(string, string) (bool, error), plain func(string) error) {
+	t.Helper()
+	oldTyped, oldPlain, oldTimeout := typedClipboardWrite, clipboardWriteAll, clipboardTimeout
+	t.Cleanup(func() {
+		typedClipboardWrite, clipboardWriteAll, clipboardTimeout = oldTyped, oldPlain, oldTimeout
+	})
+	typedClipboardWrite, clipboardWriteAll = typed, plain
+	t.Setenv("TMPDIR", t.TempDir())
+}
+
+func TestClipboardSinkTypedTimeoutFailsFast(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	var calls atomic.Int32
+	fakeClipboard(t, func(string, string) (bool, error) {
+		calls.Add(1)
+		<-block
+		return true, nil
+	}, func(string) error {
+		t.Error("fell back to the plain-text backend after a timeout")
+		return nil
+	})
+	clipboardTimeout = 20 * time.Millisecond
+
+	s := &clipboardSink{mime: "text/html", retry: true}
+	s.Write([]byte("<p>hi</p>"))
+	if err := s.write(); !errors.As(err, new(errClipboardTimeout)) {
+		t.Fatalf("write() = %v, want a wrapped errClipboardTimeout", err)
+	}
+	calls.Store(0)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("typed backend called %d times, want 1 (no retry after a timeout)", n)
+	}
+	if s.savedTo == "" {
+		t.Error("content wasn't saved to a file after the timeout")
+	}
+}
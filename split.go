@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// splitOptions configure --split-by-size/--split-by-tokens.
+type splitOptions struct {
+	maxBytes    int
+	maxTokens   int
+	counter     *tokenCounter
+	interactive bool   // copy parts to the clipboard one at a time
+	dir         string // where part files go (--out); "" is the current directory
+	onConflict  string // --on-conflict policy for a part file that already exists
+}
+
+// splitSink buffers the whole output and, on Close, cuts it into parts under
+// the limit. Parts break at file boundaries when possible; a single file that
+// is over the limit on its own is broken between lines.
+type splitSink struct {
+	opts    splitOptions
+	buf     strings.Builder
+	parts   int
+	skipped int // part files left alone by --on-conflict
+}
+
+func (s *splitSink) Write(p []byte) (int, error) { return s.buf.Write(p) }
+
+func (s *splitSink) Close() error {
+	parts := splitSections(s.buf.String(), s.size, s.limit())
+	s.parts = len(parts)
+	for i, part := range parts {
+		if s.opts.interactive {
+			if err := writeClipboard(part); err != nil {
+				return fmt.Errorf("Error writing to clipboard: %v", err)
+			}
+			if i == len(parts)-1 {
+				fmt.Printf("Part %d/%d copied to clipboard.\n", i+1, len(parts))
+				break
+			}
+			fmt.Printf("Part %d/%d copied to clipboard. Press Enter for the next part...", i+1, len(parts))
+			fmt.Scanln()
+			continue
+		}
+		name := filepath.Join(s.opts.dir, fmt.Sprintf("pull-part-%03d.txt", i+1))
+		if err := checkSandbox(name); err != nil {
+			return err
+		}
+		if i == 0 && s.opts.dir != "" {
+			if err := os.MkdirAll(s.opts.dir, 0755); err != nil {
+				return fmt.Errorf("Error creating directory: %v", err)
+			}
+		}
+		target, ok := resolveConflict(name, s.opts.onConflict)
+		if !ok {
+			warnf("Warning: skipped %s: it already exists (--on-conflict)\n", name)
+			s.skipped++
+			continue
+		}
+		if err := os.WriteFile(target, []byte(part), 0644); err != nil {
+			return fmt.Errorf("Error writing file: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *splitSink) doneMessage() string {
+	if s.opts.interactive {
+		return ""
+	}
+	msg := fmt.Sprintf("Written %d part(s) to %s", s.parts-s.skipped, filepath.Join(s.opts.dir, "pull-part-*.txt"))
+	if s.skipped > 0 {
+		msg += fmt.Sprintf(" (%d skipped)", s.skipped)
+	}
+	return msg
+}
+
+func (s *splitSink) limit() int {
+	if s.opts.maxTokens > 0 {
+		return s.opts.maxTokens
+	}
+	return s.opts.maxBytes
+}
+
+func (s *splitSink) size(text string) int {
+	if s.opts.maxTokens > 0 {
+		return s.opts.counter.count(text)
+	}
+	return len(text)
+}
+
+// splitSections packs the sections of content into parts whose size is at
+// most limit. A section starts at a header line (file:, href:, filetree:,
+// github:). Squashed output (--squash-headers) is split by splitSquashed
+// instead.
+func splitSections(content string, size func(string) int, limit int) []string {
+	if parts, ok := splitSquashed(content, size, limit); ok {
+		return parts
+	}
+	var sections []string
+	var cur strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line == "" {
+			continue
+		}
+		if isSectionHeader(line) && cur.Len() > 0 {
+			sections = append(sections, cur.String())
+			cur.Reset()
+		}
+		cur.WriteString(line)
+	}
+	if cur.Len() > 0 {
+		sections = append(sections, cur.String())
+	}
+	return packSections(sections, size, limit)
+}
+
+// packSections concatenates sections into parts of at most limit, breaking
+// a section that is over the limit by itself between lines. Sizes are kept
+// as running totals so each section and line is measured once; token counts
+// of concatenated text can differ slightly from the sum of their parts, which
+// is close enough for cutting parts.
+func packSections(sections []string, size func(string) int, limit int) []string {
+	var parts []string
+	var part strings.Builder
+	partSize := 0
+	flush := func() {
+		if part.Len() > 0 {
+			parts = append(parts, part.String())
+			part.Reset()
+			partSize = 0
+		}
+	}
+	for _, sec := range sections {
+		secSize := size(sec)
+		if partSize+secSize <= limit {
+			part.WriteString(sec)
+			partSize += secSize
+			continue
+		}
+		flush()
+		if secSize <= limit {
+			part.WriteString(sec)
+			partSize = secSize
+			continue
+		}
+		// One section is over the limit by itself: fall back to lines.
+		for _, line := range strings.SplitAfter(sec, "\n") {
+			lineSize := size(line)
+			if part.Len() > 0 && partSize+lineSize > limit {
+				flush()
+			}
+			part.WriteString(line)
+			partSize += lineSize
+		}
+	}
+	flush()
+	return parts
+}
+
+// splitSquashed splits --squash-headers output so that every part opens with
+// a "files:" index of the files it holds. ok is false when content isn't
+// squashed output, or when its blank-line boundaries don't line up with the
+// index (a --file-separator with blank lines, say); it is then split like
+// any other output.
+func splitSquashed(content string, size func(string) int, limit int) ([]string, bool) {
+	rest, ok := strings.CutPrefix(content, "files:\n")
+	if !ok {
+		return nil, false
+	}
+	index, body, ok := strings.Cut(rest, "\n\n")
+	if !ok {
+		return nil, false
+	}
+	// Every file's content follows a blank line, so the body's blank lines
+	// start the blocks, one per file that isn't identical to an earlier one.
+	var blocks []string
+	var cur strings.Builder
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if line == "" {
+			continue
+		}
+		if line == "\n" {
+			blocks = append(blocks, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteString(line)
+	}
+	blocks = append(blocks, cur.String())
+
+	type squashedFile struct {
+		entries []string // index lines: the file, then any identical to it
+		block   string
+	}
+	var files []*squashedFile
+	byPath := make(map[string]*squashedFile)
+	var orphans, notes []string
+	for _, entry := range strings.Split(index, "\n") {
+		// GitHub labels lead the files they label; deleted files are noted
+		// at the end of the index.
+		if strings.HasPrefix(entry, "github: ") || strings.HasPrefix(entry, "deleted: ") {
+			notes = append(notes, entry)
+			continue
+		}
+		if _, same, ok := strings.Cut(entry, " (identical to "); ok {
+			if f := byPath[strings.TrimSuffix(same, ")")]; f != nil {
+				f.entries = append(f.entries, entry)
+			} else {
+				orphans = append(orphans, entry)
+			}
+			continue
+		}
+		if len(files) == len(blocks) {
+			return nil, false
+		}
+		f := &squashedFile{entries: append(notes, entry), block: blocks[len(files)]}
+		notes = nil
+		files = append(files, f)
+		byPath[entry] = f
+	}
+	if len(files) != len(blocks) || len(files) == 0 {
+		return nil, false
+	}
+	files[0].entries = append(files[0].entries, orphans...)
+	last := files[len(files)-1]
+	last.entries = append(last.entries, notes...)
+
+	var parts []string
+	var entries []string
+	var blockText strings.Builder
+	partSize := 0
+	flush := func() {
+		if len(entries) > 0 {
+			parts = append(parts, "files:\n"+strings.Join(entries, "\n")+"\n"+blockText.String())
+			entries = nil
+			blockText.Reset()
+			partSize = 0
+		}
+	}
+	headerSize := size("files:\n")
+	for _, f := range files {
+		entrySize := size(strings.Join(f.entries, "\n") + "\n")
+		block := "\n" + f.block
+		blockSize := size(block)
+		if len(entries) > 0 && partSize+entrySize+blockSize > limit {
+			flush()
+		}
+		if len(entries) == 0 && headerSize+entrySize+blockSize > limit {
+			// One file is over the limit by itself: its index entry leads
+			// the first piece and the rest is broken between lines.
+			parts = append(parts, packSections([]string{"files:\n" + strings.Join(f.entries, "\n") + "\n" + block}, size, limit)...)
+			continue
+		}
+		if len(entries) == 0 {
+			partSize = headerSize
+		}
+		entries = append(entries, f.entries...)
+		blockText.WriteString(block)
+		partSize += entrySize + blockSize
+	}
+	flush()
+	return parts, true
+}
+
+func isSectionHeader(line string) bool {
+	for _, p := range []string{"file: ", "href: ", "filetree: ", "github: "} {
+		if strings.HasPrefix(line, p) {
+			return true
+		}
+	}
+	return isExtGroupHeader(strings.TrimRight(line, "\r\n"))
+}
+
+// isExtGroupHeader reports whether line (without its newline) opens a
+// --group-by-ext group.
+func isExtGroupHeader(line string) bool {
+	return strings.HasPrefix(line, "=== ") && (strings.HasSuffix(line, " files ===") || line == "=== files without an extension ===")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitSectionsSquashed(t *testing.T) {
+	content := "files:\na.go\nb.go\nc.go (identical to a.go)\n\naaaa\n\nbbbb\n"
+	parts := splitSections(content, func(s string) int { return len(s) }, 48)
+	want := []string{
+		"files:\na.go\nc.go (identical to a.go)\n\naaaa\n",
+		"files:\nb.go\n\nbbbb\n",
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("got %d parts %q, want %q", len(parts), parts, want)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("part %d = %q, want %q", i+1, parts[i], want[i])
+		}
+	}
+}
+
+func TestSplitSectionsMeasuresEachLineOnce(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		sb.WriteString("file: x.go\nline\n")
+	}
+	measured := 0
+	size := func(s string) int {
+		measured += len(s)
+		return len(s)
+	}
+	parts := splitSections(sb.String(), size, 64)
+	if got := strings.Join(parts, ""); got != sb.String() {
+		t.Fatalf("parts don't add up to the input")
+	}
+	if measured != sb.Len() {
+		t.Errorf("measured %d bytes, want %d", measured, sb.Len())
+	}
+}
+
+func TestSplitSinkOnConflict(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   map[string]string
+	}{
+		{conflictOverwrite, map[string]string{"pull-part-001.txt": "file: a\n", "pull-part-002.txt": "file: b\n"}},
+		{conflictSkip, map[string]string{"pull-part-001.txt": "old\n", "pull-part-002.txt": "file: b\n"}},
+		{conflictRename, map[string]string{"pull-part-001.txt": "old\n", "pull-part-001-1.txt": "file: a\n", "pull-part-002.txt": "file: b\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "parts")
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "pull-part-001.txt"), []byte("old\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s := &splitSink{opts: splitOptions{maxBytes: 8, dir: dir, onConflict: tt.policy}}
+			s.Write([]byte("file: a\nfile: b\n"))
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != len(tt.want) {
+				t.Errorf("got %d files, want %d", len(entries), len(tt.want))
+			}
+			for name, want := range tt.want {
+				if b, _ := os.ReadFile(filepath.Join(dir, name)); string(b) != want {
+					t.Errorf("%s = %q, want %q", name, b, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxStackEntries caps the clipboard stack (push/pop); pushing onto a full
+// stack drops the oldest entry.
+const maxStackEntries = 20
+
+// stateDir is where pull keeps state between runs: $XDG_STATE_HOME/pull, or
+// ~/.local/state/pull.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "pull"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Error: no state directory: %v", err)
+	}
+	return filepath.Join(home, ".local", "state", "pull"), nil
+}
+
+// stackEntry is one saved clipboard. The stack is stored as a JSON array,
+// oldest first.
+type stackEntry struct {
+	Saved   time.Time `json:"saved"`
+	Content string    `json:"content"`
+}
+
+func stackPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "stack.json"), nil
+}
+
+func readStack() ([]stackEntry, error) {
+	p, err := stackPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error: reading clipboard stack: %v", err)
+	}
+	var stack []stackEntry
+	if err := json.Unmarshal(b, &stack); err != nil {
+		return nil, fmt.Errorf("Error: reading clipboard stack %s: %v", p, err)
+	}
+	return stack, nil
+}
+
+func writeStack(stack []stackEntry) error {
+	p, err := stackPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("Error creating directory: %v", err)
+	}
+	b, err := json.Marshal(stack)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p, b, 0600); err != nil {
+		return fmt.Errorf("Error: writing clipboard stack: %v", err)
+	}
+	return nil
+}
+
+// pushClipboard saves the clipboard on top of the stack.
+func pushClipboard() error {
+	content, err := readClipboard()
+	if err != nil {
+		return fmt.Errorf("Error reading clipboard: %v", err)
+	}
+	if content == "" {
+		return fmt.Errorf("Error: the clipboard is empty; nothing to push")
+	}
+	stack, err := readStack()
+	if err != nil {
+		return err
+	}
+	stack = append(stack, stackEntry{Saved: time.Now(), Content: content})
+	if n := len(stack) - maxStackEntries; n > 0 {
+		stack = stack[n:]
+		infof("Clipboard stack is full; dropped the oldest %d entry(s)\n", n)
+	}
+	if err := writeStack(stack); err != nil {
+		return err
+	}
+	fmt.Printf("Pushed %d bytes (stack depth %d).\n", len(content), len(stack))
+	return nil
+}
+
+// popClipboard restores the top of the stack to the clipboard and removes it.
+// The entry is only removed once the clipboard write has succeeded.
+func popClipboard() error {
+	stack, err := readStack()
+	if err != nil {
+		return err
+	}
+	if len(stack) == 0 {
+		return fmt.Errorf("Error: the clipboard stack is empty")
+	}
+	top := stack[len(stack)-1]
+	if err := writeClipboard(top.Content); err != nil {
+		return fmt.Errorf("Error writing to clipboard: %v", err)
+	}
+	if err := writeStack(stack[:len(stack)-1]); err != nil {
+		return err
+	}
+	fmt.Printf("Popped %d bytes to the clipboard (stack depth %d).\n", len(top.Content), len(stack)-1)
+	return nil
+}
+
+// listStack prints the stack top first: position, size, when it was saved,
+// and the first line of the content.
+func listStack(w io.Writer) error {
+	stack, err := readStack()
+	if err != nil {
+		return err
+	}
+	if len(stack) == 0 {
+		fmt.Fprintln(w, "The clipboard stack is empty.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i := len(stack) - 1; i >= 0; i-- {
+		e := stack[i]
+		fmt.Fprintf(tw, "%d\t%d bytes\t%s\t%s\n", len(stack)-i, len(e.Content), e.Saved.Format("2006-01-02 15:04"), preview(e.Content))
+	}
+	return tw.Flush()
+}
+
+// preview returns the first non-blank line of s, cut to 60 characters.
+func preview(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if r := []rune(line); len(r) > 60 {
+				return string(r[:60]) + "…"
+			}
+			return line
+		}
+	}
+	return ""
+}
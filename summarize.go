@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSummaryBaseURL = "https://api.openai.com/v1"
+	defaultSummaryModel   = "gpt-4o-mini"
+	defaultSummaryPrompt  = "Summarize the following files for a developer who will continue working on them. Describe what each file does, how they fit together, and anything notable. Keep file paths exactly as given."
+
+	// summaryTimeout is generous: a large pull can take the model a while.
+	summaryTimeout = 3 * time.Minute
+)
+
+// summaryOptions configure --summarize: an OpenAI-compatible chat completions
+// endpoint that turns the pull into a digest.
+type summaryOptions struct {
+	baseURL string
+	apiKey  string
+	model   string
+	prompt  string
+
+	fetch fetchOptions // HTTP settings shared with href (--retries)
+}
+
+// resolveSummaryOptions fills in unset flags from the environment and defaults.
+// There is no useful fallback without an API key, so that is an error.
+func resolveSummaryOptions(o summaryOptions) (summaryOptions, error) {
+	o.baseURL = firstNonEmpty(o.baseURL, os.Getenv("PULL_SUMMARY_BASE_URL"), os.Getenv("OPENAI_BASE_URL"), defaultSummaryBaseURL)
+	o.apiKey = firstNonEmpty(os.Getenv("PULL_SUMMARY_API_KEY"), os.Getenv("OPENAI_API_KEY"))
+	o.model = firstNonEmpty(o.model, os.Getenv("PULL_SUMMARY_MODEL"), defaultSummaryModel)
+	o.prompt = firstNonEmpty(o.prompt, defaultSummaryPrompt)
+	if o.apiKey == "" {
+		return o, fmt.Errorf("Error: --summarize needs an API key in $PULL_SUMMARY_API_KEY or $OPENAI_API_KEY")
+	}
+	return o, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// summarySink decorates a sink with --summarize: the pull is buffered, and on
+// Close the model's summary is written to the inner sink in its place.
+type summarySink struct {
+	sink
+	opts summaryOptions
+	buf  strings.Builder
+}
+
+func (s *summarySink) Write(p []byte) (int, error) { return s.buf.Write(p) }
+
+func (s *summarySink) Close() error {
+	if s.buf.Len() == 0 {
+		return s.sink.Close()
+	}
+	summary, err := summarize(s.buf.String(), s.opts)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(summary, "\n") {
+		summary += "\n"
+	}
+	io.WriteString(s.sink, summary)
+	return s.sink.Close()
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func summarize(content string, o summaryOptions) (string, error) {
+	body, _ := json.Marshal(map[string]any{
+		"model": o.model,
+		"messages": []chatMessage{
+			{Role: "system", Content: o.prompt},
+			{Role: "user", Content: content},
+		},
+	})
+	u := strings.TrimRight(o.baseURL, "/") + "/chat/completions"
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", "Bearer "+o.apiKey)
+
+	fetch := o.fetch
+	fetch.timeout = summaryTimeout
+	resp, err := fetch.send(http.MethodPost, u, body, header)
+	if err != nil {
+		return "", fmt.Errorf("Error: summarize: request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := readUpTo(resp.Body, maxFetchBytes)
+	if err != nil {
+		return "", fmt.Errorf("Error: summarize: reading response: %v", err)
+	}
+
+	var parsed struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	jsonErr := json.Unmarshal(b, &parsed)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if jsonErr == nil && parsed.Error != nil && parsed.Error.Message != "" {
+			return "", fmt.Errorf("Error: summarize: %s: %s", resp.Status, parsed.Error.Message)
+		}
+		return "", fmt.Errorf("Error: summarize: %s", resp.Status)
+	}
+	if jsonErr != nil || len(parsed.Choices) == 0 {
+		return "", fmt.Errorf("Error: summarize: unexpected response from %s", u)
+	}
+	return parsed.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// tokenCounter counts tokens either exactly, with a model's BPE encoding, or
+// with the chars/4 estimate. The encoder is built once and reused for every
+// file, since loading the ranks is far more expensive than encoding.
+type tokenCounter struct {
+	model string
+	enc   *tiktoken.Tiktoken // nil means estimate
+}
+
+func newTokenCounter(model string) *tokenCounter {
+	c := &tokenCounter{model: model}
+	if model == "" {
+		return c
+	}
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		warnf("Warning: no tokenizer for model %q; using the chars/4 estimate\n", model)
+		return c
+	}
+	c.enc = enc
+	return c
+}
+
+func (c *tokenCounter) count(s string) int {
+	if c.enc != nil {
+		return len(c.enc.EncodeOrdinary(s))
+	}
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// label describes how tokens were counted, for the summary line.
+func (c *tokenCounter) label() string {
+	if c.enc != nil {
+		return c.model + " tokens"
+	}
+	return "tokens (est.)"
+}
+
+// pullStats totals what an emitter has written.
+type pullStats struct {
+	files  int
+	bytes  int
+	lines  int
+	tokens int
+
+	perFile bool       // keep byFile for --count-per-file
+	byFile  []fileStat // one entry per file, in emit order
+}
+
+// fileStat is one file's share of a pull.
+type fileStat struct {
+	path   string
+	bytes  int
+	lines  int
+	tokens int
+}
+
+func (s *pullStats) add(rec fileRecord, c *tokenCounter) {
+	fs := fileStat{
+		path:   rec.RelPath,
+		bytes:  len(rec.Content),
+		lines:  strings.Count(rec.Content, "\n"),
+		tokens: c.count(rec.Content),
+	}
+	if fs.path == "" {
+		fs.path = rec.Path
+	}
+	s.files++
+	s.bytes += fs.bytes
+	s.lines += fs.lines
+	s.tokens += fs.tokens
+	if s.perFile {
+		s.byFile = append(s.byFile, fs)
+	}
+}
+
+func (s *pullStats) line(c *tokenCounter) string {
+	return fmt.Sprintf("%d files, %d bytes, %d lines, %d %s", s.files, s.bytes, s.lines, s.tokens, c.label())
+}
+
+func (s *pullStats) report(c *tokenCounter) {
+	fmt.Fprintln(os.Stderr, s.line(c))
+}
+
+// reportFiles writes the --count-per-file table: every file, largest token
+// count first, with its share of the pull and the running total of shares.
+func (s *pullStats) reportFiles(w io.Writer) {
+	files := append([]fileStat(nil), s.byFile...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].tokens > files[j].tokens })
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TOKENS\tBYTES\tLINES\tSHARE\tCUMUL\t  PATH")
+	cum := 0
+	for _, f := range files {
+		cum += f.tokens
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t  %s\n", f.tokens, f.bytes, f.lines, percent(f.tokens, s.tokens), percent(cum, s.tokens), f.path)
+	}
+	tw.Flush()
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
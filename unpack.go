@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unpackedFile is one file: section read back from pulled content.
+type unpackedFile struct {
+	path    string // as written in the header
+	sameAs  string // the file it is identical to (--dedupe-content)
+	content strings.Builder
+}
+
+// parseFileSections reads the file: sections (and --merge-adjacent
+// "// file:" markers) out of plain-format pull output. href: and other
+// sections are skipped, since they don't name files. A --dedupe-content
+// reference gets the content of the file it names.
+func parseFileSections(content string) []*unpackedFile {
+	var files []*unpackedFile
+	var cur *unpackedFile
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line == "" {
+			continue
+		}
+		header := strings.TrimRight(line, "\r\n")
+		if p, ok := strings.CutPrefix(strings.TrimPrefix(header, "// "), "file: "); ok {
+			p, sameAs := splitDedupedPath(strings.TrimSpace(p))
+			cur = &unpackedFile{path: p, sameAs: sameAs}
+			files = append(files, cur)
+			continue
+		}
+		if isSectionHeader(line) || header == "merged:" || header == "files:" {
+			cur = nil
+			continue
+		}
+		if cur != nil {
+			cur.content.WriteString(line)
+		}
+	}
+	byPath := make(map[string]*unpackedFile)
+	for _, f := range files {
+		if f.sameAs == "" {
+			byPath[f.path] = f
+		} else if orig := byPath[f.sameAs]; orig != nil {
+			f.content.WriteString(orig.content.String())
+		}
+	}
+	return files
+}
+
+// mirrorPaths maps header paths to paths relative to the output root.
+// Relative headers are kept as they are; absolute ones are taken relative to
+// the deepest directory they all share, so the pulled subtree is recreated.
+// Paths that would climb out of the root are rejected.
+func mirrorPaths(paths []string) ([]string, error) {
+	common := ""
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			continue
+		}
+		dir := filepath.Dir(filepath.Clean(p))
+		if common == "" {
+			common = dir
+			continue
+		}
+		for !isWithin(common, dir) && common != filepath.Dir(common) {
+			common = filepath.Dir(common)
+		}
+	}
+	rels := make([]string, len(paths))
+	for i, p := range paths {
+		rel := filepath.Clean(filepath.FromSlash(p))
+		if filepath.IsAbs(rel) {
+			r, err := filepath.Rel(common, rel)
+			if err != nil {
+				return nil, fmt.Errorf("Error: can't place %s under the output directory", p)
+			}
+			rel = r
+		}
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+			return nil, fmt.Errorf("Error: refusing to write %s outside the output directory", p)
+		}
+		rels[i] = rel
+	}
+	return rels, nil
+}
+
+// unpackFiles writes every file: section of content under root, mirroring the
+// pulled directory structure (the split command). Existing files follow the
+// --on-conflict policy.
+func unpackFiles(content string, root string, opts writeOptions) error {
+	files := parseFileSections(content)
+	if len(files) == 0 {
+		return fmt.Errorf("Error: no file: sections to split")
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	rels, err := mirrorPaths(paths)
+	if err != nil {
+		return err
+	}
+	written := 0
+	for i, f := range files {
+		target, ok := resolveConflict(filepath.Join(root, rels[i]), opts.onConflict)
+		if !ok {
+			infof("Skipped: %s already exists\n", filepath.Join(root, rels[i]))
+			continue
+		}
+		if err := checkSandbox(target); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("Error creating directory: %v", err)
+		}
+		mode := opts.mode
+		if st, err := os.Stat(target); err == nil {
+			mode = st.Mode().Perm()
+		}
+		if err := writeFileAtomic(target, []byte(f.content.String()), mode); err != nil {
+			return fmt.Errorf("Error writing file: %v", err)
+		}
+		verbosef("Wrote %s\n", target)
+		written++
+	}
+	fmt.Printf("Wrote %d file(s) under %s\n", written, root)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxWalkCacheEntries caps the walk cache (--cache); the least recently used
+// entries go first.
+const maxWalkCacheEntries = 64
+
+// walkRecord collects what a walk depended on, so a cached result can be
+// checked without walking again: the modification time of every directory
+// read, and the state of every ignore or attributes file consulted and of
+// every file sniffed for binary content.
+type walkRecord struct {
+	Dirs  map[string]int64  `json:"dirs"`  // directory -> mtime (ns)
+	Files map[string]string `json:"files"` // file -> fileStamp
+}
+
+func newWalkRecord() *walkRecord {
+	return &walkRecord{Dirs: make(map[string]int64), Files: make(map[string]string)}
+}
+
+func (r *walkRecord) dir(p string) {
+	if st, err := os.Stat(p); err == nil {
+		r.Dirs[p] = st.ModTime().UnixNano()
+	}
+}
+
+// racy reports whether a directory changed so shortly before the walk that a
+// later change could leave its mtime as it is (timestamps are coarse on many
+// file systems). Such a walk isn't cached; the next one will be.
+func (r *walkRecord) racy(since time.Time) bool {
+	limit := since.Add(-time.Second).UnixNano()
+	for _, mtime := range r.Dirs {
+		if mtime >= limit {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *walkRecord) file(p string) {
+	r.Files[p] = fileStamp(p)
+}
+
+// fileStamp identifies a version of a file by size and mtime; "-" means the
+// file doesn't exist, which matters too: creating a .gitignore changes a walk.
+func fileStamp(p string) string {
+	st, err := os.Stat(p)
+	if err != nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", st.Size(), st.ModTime().UnixNano())
+}
+
+// fresh reports whether nothing the walk depended on has changed.
+func (r *walkRecord) fresh() bool {
+	for p, mtime := range r.Dirs {
+		st, err := os.Stat(p)
+		if err != nil || st.ModTime().UnixNano() != mtime {
+			return false
+		}
+	}
+	for p, stamp := range r.Files {
+		if fileStamp(p) != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+type walkCacheEntry struct {
+	Used  time.Time   `json:"used"`
+	Files []string    `json:"files"`
+	Deps  *walkRecord `json:"deps"`
+}
+
+// walkCache maps a walk's key (start path, working directory, and filter
+// settings) to its filtered file list. It is one JSON file in the state
+// directory and can be deleted at any time.
+type walkCache struct {
+	path    string
+	entries map[string]*walkCacheEntry
+	dirty   bool
+}
+
+func openWalkCache() *walkCache {
+	c := &walkCache{entries: make(map[string]*walkCacheEntry)}
+	dir, err := stateDir()
+	if err != nil {
+		return c
+	}
+	c.path = filepath.Join(dir, "walkcache.json")
+	if b, err := os.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			verbosef("Ignoring unreadable walk cache %s: %v\n", c.path, err)
+			c.entries = make(map[string]*walkCacheEntry)
+		}
+	}
+	return c
+}
+
+func walkCacheKey(startPath string, fingerprint string) string {
+	wd, _ := os.Getwd()
+	sum := sha256.Sum256([]byte(wd + "\x00" + startPath + "\x00" + fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// walkFingerprint describes the settings that decide which files a walk
+// keeps, so a cached list is only reused for the same filtering.
+func walkFingerprint(f *localFilter, excludes, includes []string) string {
+	exts := make([]string, 0, len(f.exts))
+	for e := range f.exts {
+		exts = append(exts, e)
+	}
+	sort.Strings(exts)
+	b, _ := json.Marshal([]any{
+		f.includeIgnored, f.includeHidden, f.includeVCS, f.ignoreSymlinks,
+		f.includeBinary, f.respectBinaryAttrs, f.globalExcludes, f.tests,
+		f.order, exts, excludes, includes,
+	})
+	return string(b)
+}
+
+// collect returns the filtered files under startPath, from the cache when
+// nothing they depend on has changed. refresh skips the lookup but still
+// stores the new result.
+func (c *walkCache) collect(startPath string, f *localFilter, fingerprint string, refresh bool) ([]string, error) {
+	key := walkCacheKey(startPath, fingerprint)
+	if e, ok := c.entries[key]; ok && !refresh && e.Deps != nil && e.Deps.fresh() {
+		verbosef("Walk cache hit for %s (%d files)\n", startPath, len(e.Files))
+		e.Used = time.Now()
+		c.dirty = true
+		return e.Files, nil
+	}
+	started := time.Now()
+	deps := newWalkRecord()
+	walkFilter := *f
+	walkFilter.walked = deps
+	walkFilter.noteRepoFiles()
+	files, err := collectLocalFiles(startPath, &walkFilter)
+	if err != nil {
+		return files, err
+	}
+	if deps.racy(started) {
+		verbosef("Not caching the walk of %s: it changed too recently\n", startPath)
+		delete(c.entries, key)
+		c.dirty = true
+		return files, nil
+	}
+	c.entries[key] = &walkCacheEntry{Used: time.Now(), Files: files, Deps: deps}
+	c.dirty = true
+	return files, nil
+}
+
+// save writes the cache back, dropping the least recently used entries past
+// maxWalkCacheEntries. Failing to save only costs speed, so it just warns.
+func (c *walkCache) save() {
+	if !c.dirty || c.path == "" {
+		return
+	}
+	if len(c.entries) > maxWalkCacheEntries {
+		keys := make([]string, 0, len(c.entries))
+		for k := range c.entries {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return c.entries[keys[i]].Used.After(c.entries[keys[j]].Used) })
+		for _, k := range keys[maxWalkCacheEntries:] {
+			delete(c.entries, k)
+		}
+	}
+	b, err := json.Marshal(c.entries)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(c.path), 0700); err == nil {
+			err = writeFileAtomic(c.path, b, 0600)
+		}
+	}
+	if err != nil {
+		warnf("Warning: could not save the walk cache: %v\n", err)
+	}
+}
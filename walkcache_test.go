@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// benchTree generates a repository of dirs x files small Go files, with a
+// .gitignore and some ignored build output, and backdates every directory
+// so the walk cache doesn't consider it racy.
+func benchTree(b *testing.B, dirs int, files int) string {
+	b.Helper()
+	root := b.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("build/\n*.log\n"), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	for d := 0; d < dirs; d++ {
+		for _, sub := range []string{fmt.Sprintf("pkg%03d", d), filepath.Join("build", fmt.Sprintf("pkg%03d", d))} {
+			dir := filepath.Join(root, sub)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				b.Fatal(err)
+			}
+			for f := 0; f < files; f++ {
+				content := fmt.Sprintf("package pkg%03d\n\nfunc F%d() int { return %d }\n", d, f, f)
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.go", f)), []byte(content), 0o644); err != nil {
+					b.Fatal(err)
+				}
+			}
+			os.WriteFile(filepath.Join(dir, "debug.log"), []byte("log\n"), 0o644)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chtimes(p, old, old)
+		}
+		return nil
+	})
+	return root
+}
+
+func BenchmarkCollectLocalFiles(b *testing.B) {
+	root := benchTree(b, 50, 40)
+	f := (&localFilter{}).forStart(root)
+
+	b.Run("walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := collectLocalFiles(root, f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		cache := &walkCache{entries: make(map[string]*walkCacheEntry)}
+		fingerprint := walkFingerprint(f, nil, nil)
+		for i := 0; i < b.N; i++ {
+			if _, err := cache.collect(root, f, fingerprint, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// proseExts are the file types --wrap applies to unless --wrap-all is set.
+// href responses count as prose too.
+var proseExts = map[string]bool{
+	"":      true,
+	".md":   true,
+	".txt":  true,
+	".rst":  true,
+	".adoc": true,
+	".org":  true,
+	".html": true,
+}
+
+// wrapText hard-wraps every line of s at cols runes, breaking between words.
+// Wrapped lines keep the original line's indentation. A word longer than the
+// line is left whole on a line of its own.
+func wrapText(s string, cols int) string {
+	var sb strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		body := strings.TrimRight(line, "\r\n")
+		if utf8.RuneCountInString(body) <= cols {
+			sb.WriteString(line)
+			continue
+		}
+		indent := body[:len(body)-len(strings.TrimLeft(body, " \t"))]
+		width := 0
+		for i, word := range strings.Fields(body) {
+			n := utf8.RuneCountInString(word)
+			switch {
+			case i == 0:
+				sb.WriteString(indent + word)
+				width = utf8.RuneCountInString(indent) + n
+			case width+1+n > cols:
+				sb.WriteString("\n" + indent + word)
+				width = utf8.RuneCountInString(indent) + n
+			default:
+				sb.WriteString(" " + word)
+				width += 1 + n
+			}
+		}
+		sb.WriteString(line[len(body):])
+	}
+	return sb.String()
+}